@@ -7,22 +7,26 @@ import (
 )
 
 func main() {
-	conn, err := dbus.SessionBus()
+	conn, err := dbus.SessionBusPrivate()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to connect to session bus:", err)
 		os.Exit(1)
 	}
-
-	for _, v := range []string{"method_call", "method_return", "error", "signal"} {
-		call := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
-			"eavesdrop='true',type='"+v+"'")
-		if call.Err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to add match:", call.Err)
-			os.Exit(1)
-		}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to authenticate:", err)
+		os.Exit(1)
+	}
+	if err = conn.Hello(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to send Hello:", err)
+		os.Exit(1)
 	}
+
 	c := make(chan *dbus.Message, 10)
-	conn.Eavesdrop(c)
+	if err := conn.BecomeMonitor(c); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to become monitor:", err)
+		os.Exit(1)
+	}
 	fmt.Println("Listening for everything")
 	for v := range c {
 		fmt.Println(v)
@@ -3,18 +3,9 @@ package main
 import (
 	"fmt"
 	"github.com/godbus/dbus"
-	"github.com/godbus/dbus/introspect"
 	"os"
 )
 
-const intro = `
-<node>
-	<interface name="com.github.guelfey.Demo">
-		<method name="Foo">
-			<arg direction="out" type="s"/>
-		</method>
-	</interface>` + introspect.IntrospectDataString + `</node> `
-
 type foo string
 
 func (f foo) Foo() (string, *dbus.Error) {
@@ -38,8 +29,6 @@ func main() {
 	}
 	f := foo("Bar!")
 	conn.Export(f, "/com/github/guelfey/Demo", "com.github.guelfey.Demo")
-	conn.Export(introspect.Introspectable(intro), "/com/github/guelfey/Demo",
-		"org.freedesktop.DBus.Introspectable")
 	fmt.Println("Listening on com.github.guelfey.Demo / /com/github/guelfey/Demo ...")
 	select {}
 }
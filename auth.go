@@ -56,6 +56,16 @@ func (conn *Conn) Auth(methods []Auth) error {
 		uid := strconv.Itoa(os.Getuid())
 		methods = []Auth{AuthExternal(uid), AuthCookieSha1(uid, getHomeDir())}
 	}
+	if err := conn.auth(methods); err != nil {
+		return err
+	}
+	conn.authMethods = methods
+	go conn.inWorker()
+	return nil
+}
+
+// auth runs the authentication protocol on conn.transport.
+func (conn *Conn) auth(methods []Auth) error {
 	in := bufio.NewReader(conn.transport)
 	err := conn.transport.SendNullByte()
 	if err != nil {
@@ -115,7 +125,6 @@ func (conn *Conn) Auth(methods []Auth) error {
 					if err != nil {
 						return err
 					}
-					go conn.inWorker()
 					return nil
 				}
 			}
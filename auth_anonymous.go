@@ -14,3 +14,23 @@ func (a *authAnonymous) FirstData() (name, resp []byte, status AuthStatus) {
 func (a *authAnonymous) HandleData(data []byte) (resp []byte, status AuthStatus) {
 	return nil, AuthError
 }
+
+// ServerAuthAnonymous returns a ServerAuth that implements the server side of
+// the ANONYMOUS mechanism, i.e. one that accepts every peer.
+func ServerAuthAnonymous() ServerAuth {
+	return serverAuthAnonymous{}
+}
+
+type serverAuthAnonymous struct{}
+
+func (a serverAuthAnonymous) Name() []byte {
+	return []byte("ANONYMOUS")
+}
+
+func (a serverAuthAnonymous) Start(creds *PeerCredentials) ServerAuthHandler {
+	return a
+}
+
+func (a serverAuthAnonymous) HandleData(data []byte) ([]byte, AuthStatus) {
+	return nil, AuthOk
+}
@@ -2,6 +2,8 @@ package dbus
 
 import (
 	"encoding/hex"
+	"os"
+	"strconv"
 )
 
 // AuthExternal returns an Auth that authenticates as the given user with the
@@ -24,3 +26,53 @@ func (a authExternal) FirstData() ([]byte, []byte, AuthStatus) {
 func (a authExternal) HandleData(b []byte) ([]byte, AuthStatus) {
 	return nil, AuthError
 }
+
+// ServerAuthExternal returns a ServerAuth that implements the server side of
+// the EXTERNAL mechanism. Peers are authenticated by the credentials that the
+// transport reports for them; only peers running as one of the given uids are
+// accepted. If no uids are given, only the uid of the current process is
+// accepted.
+func ServerAuthExternal(uids ...uint32) ServerAuth {
+	if len(uids) == 0 {
+		uids = []uint32{uint32(os.Getuid())}
+	}
+	return serverAuthExternal{uids}
+}
+
+type serverAuthExternal struct {
+	uids []uint32
+}
+
+func (a serverAuthExternal) Name() []byte {
+	return []byte("EXTERNAL")
+}
+
+func (a serverAuthExternal) Start(creds *PeerCredentials) ServerAuthHandler {
+	return &serverAuthExternalHandler{a.uids, creds, false}
+}
+
+type serverAuthExternalHandler struct {
+	uids    []uint32
+	creds   *PeerCredentials
+	waiting bool
+}
+
+func (h *serverAuthExternalHandler) HandleData(data []byte) ([]byte, AuthStatus) {
+	if h.creds == nil {
+		return nil, AuthError
+	}
+	if len(data) == 0 && !h.waiting {
+		// no initial response; ask the peer for its identity
+		h.waiting = true
+		return nil, AuthContinue
+	}
+	if len(data) != 0 && string(data) != strconv.FormatUint(uint64(h.creds.Uid), 10) {
+		return nil, AuthError
+	}
+	for _, uid := range h.uids {
+		if uid == h.creds.Uid {
+			return nil, AuthOk
+		}
+	}
+	return nil, AuthError
+}
@@ -5,8 +5,13 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
 // AuthCookieSha1 returns an Auth that authenticates as the given user with the
@@ -100,3 +105,163 @@ func (a authCookieSha1) generateChallenge() []byte {
 	hex.Encode(enc, b)
 	return enc
 }
+
+const (
+	// cookieContext is the keyring that is used by the server side of the
+	// DBUS_COOKIE_SHA1 mechanism.
+	cookieContext = "org_freedesktop_general"
+
+	// cookieMaxAge is the age after which no new authentications are
+	// started with a cookie; cookieExpireAge the age after which a cookie is
+	// removed from the keyring.
+	cookieMaxAge    = 5 * time.Minute
+	cookieExpireAge = 7 * time.Minute
+)
+
+// ServerAuthCookieSha1 returns a ServerAuth that implements the server side of
+// the DBUS_COOKIE_SHA1 mechanism. Peers must authenticate as the user the
+// current process runs as; the home parameter should specify the home
+// directory of that user, whose keyring is used.
+func ServerAuthCookieSha1(home string) ServerAuth {
+	return serverAuthCookieSha1{home}
+}
+
+type serverAuthCookieSha1 struct {
+	home string
+}
+
+func (a serverAuthCookieSha1) Name() []byte {
+	return []byte("DBUS_COOKIE_SHA1")
+}
+
+func (a serverAuthCookieSha1) Start(creds *PeerCredentials) ServerAuthHandler {
+	return &serverAuthCookieSha1Handler{home: a.home}
+}
+
+type serverAuthCookieSha1Handler struct {
+	home        string
+	cookie      []byte
+	svchallenge []byte
+}
+
+func (h *serverAuthCookieSha1Handler) HandleData(data []byte) ([]byte, AuthStatus) {
+	if h.cookie == nil {
+		// initial response: the user to authenticate as
+		if string(data) != strconv.Itoa(os.Getuid()) {
+			return nil, AuthError
+		}
+		id, cookie, err := h.loadCookie()
+		if err != nil {
+			return nil, AuthError
+		}
+		h.cookie = cookie
+		h.svchallenge = authCookieSha1{}.generateChallenge()
+		if h.svchallenge == nil {
+			return nil, AuthError
+		}
+		return bytes.Join([][]byte{[]byte(cookieContext), id, h.svchallenge}, []byte{' '}), AuthContinue
+	}
+	b := bytes.Split(data, []byte{' '})
+	if len(b) != 2 {
+		return nil, AuthError
+	}
+	hash := sha1.New()
+	hash.Write(bytes.Join([][]byte{h.svchallenge, b[0], h.cookie}, []byte{':'}))
+	hexhash := make([]byte, 2*hash.Size())
+	hex.Encode(hexhash, hash.Sum(nil))
+	if subtle.ConstantTimeCompare(hexhash, b[1]) != 1 {
+		return nil, AuthError
+	}
+	return nil, AuthOk
+}
+
+// loadCookie returns a cookie that is valid for new authentications from the
+// keyring, creating it if necessary, and its id.
+func (h *serverAuthCookieSha1Handler) loadCookie() (id, cookie []byte, err error) {
+	dir := filepath.Join(h.home, ".dbus-keyrings")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	name := filepath.Join(dir, cookieContext)
+	unlock, err := lockKeyring(name + ".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	var (
+		lines  [][]byte
+		maxID  uint64
+		now    = time.Now()
+		buf, _ = ioutil.ReadFile(name)
+	)
+	for _, line := range bytes.Split(buf, []byte{'\n'}) {
+		f := bytes.Split(line, []byte{' '})
+		if len(f) != 3 {
+			continue
+		}
+		n, err1 := strconv.ParseUint(string(f[0]), 10, 32)
+		t, err2 := strconv.ParseInt(string(f[1]), 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		age := now.Sub(time.Unix(t, 0))
+		if age < 0 || age > cookieExpireAge {
+			continue
+		}
+		if n > maxID {
+			maxID = n
+		}
+		lines = append(lines, line)
+		if age < cookieMaxAge {
+			id, cookie = f[0], f[2]
+		}
+	}
+	if cookie != nil {
+		return id, cookie, nil
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, err
+	}
+	id = []byte(strconv.FormatUint(maxID+1, 10))
+	cookie = make([]byte, hex.EncodedLen(len(b)))
+	hex.Encode(cookie, b)
+	lines = append(lines, bytes.Join([][]byte{id, []byte(strconv.FormatInt(now.Unix(), 10)), cookie}, []byte{' '}))
+	var out bytes.Buffer
+	for _, line := range lines {
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return nil, nil, err
+	}
+	return id, cookie, nil
+}
+
+// lockKeyring creates the given lock file, waiting for a while if it is held
+// by someone else. Stale locks are removed. The returned function releases
+// the lock.
+func lockKeyring(name string) (func(), error) {
+	for i := 0; ; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if i == 32 {
+			// the lock is probably stale
+			os.Remove(name)
+		} else if i > 32 {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,290 @@
+// Package bus implements a D-Bus message bus, i.e. the org.freedesktop.DBus
+// service, that can be embedded into Go programs. It is useful for tests and
+// for environments that don't provide a dbus-daemon.
+//
+// Clients connect to it over the transports supported by package dbus, so
+// connections created with dbus.Dial (followed by Auth and Hello) work as
+// they would with any other message bus.
+package bus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	busName  = "org.freedesktop.DBus"
+	busPath  = dbus.ObjectPath("/org/freedesktop/DBus")
+	busIface = "org.freedesktop.DBus"
+)
+
+// Bus is a message bus. It is safe for concurrent use by multiple goroutines.
+type Bus struct {
+	mu      sync.Mutex
+	id      string
+	serial  uint64
+	clients map[string]*client
+	conns   map[*client]struct{}
+	names   map[string]*name
+	servers []*dbus.Server
+	closed  bool
+}
+
+// New returns a new message bus without any clients. Use Listen or Serve to
+// make it reachable.
+func New() *Bus {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return &Bus{
+		id:      hex.EncodeToString(b),
+		clients: make(map[string]*client),
+		conns:   make(map[*client]struct{}),
+		names:   make(map[string]*name),
+	}
+}
+
+// Listen starts accepting connections on the given address in the
+// background, as described for dbus.Listen, and returns the address that
+// clients can pass to dbus.Dial.
+func (b *Bus) Listen(address string) (string, error) {
+	srv, err := dbus.Listen(address)
+	if err != nil {
+		return "", err
+	}
+	go b.Serve(srv)
+	return srv.Address(), nil
+}
+
+// Serve accepts connections from srv and handles them until srv or the bus
+// is closed. The server is closed when the bus is closed.
+func (b *Bus) Serve(srv *dbus.Server) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		srv.Close()
+		return dbus.ErrServerClosed
+	}
+	b.servers = append(b.servers, srv)
+	b.mu.Unlock()
+	for {
+		conn, err := srv.AcceptRaw()
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return dbus.ErrServerClosed
+		}
+		c := newClient(b, conn)
+		b.conns[c] = struct{}{}
+		b.mu.Unlock()
+		go c.readLoop()
+		go c.writeLoop()
+	}
+}
+
+// Close closes all servers and disconnects all clients.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	servers := b.servers
+	b.servers = nil
+	conns := make([]*client, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+	for _, srv := range servers {
+		srv.Close()
+	}
+	for _, c := range conns {
+		c.conn.Close()
+	}
+	return nil
+}
+
+// route dispatches a message that was received from c.
+func (b *Bus) route(c *client, msg *dbus.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.disconnected {
+		closeUnixFDs(msg)
+		return
+	}
+	if c.name == "" {
+		member := headerString(msg, dbus.FieldMember)
+		if msg.Type != dbus.TypeMethodCall || member != "Hello" ||
+			headerString(msg, dbus.FieldDestination) != busName {
+			// the first message must be a call to Hello
+			closeUnixFDs(msg)
+			c.conn.Close()
+			return
+		}
+	}
+	msg.Headers[dbus.FieldSender] = dbus.MakeVariant(c.name)
+	dest := headerString(msg, dbus.FieldDestination)
+	switch {
+	case dest == busName:
+		closeUnixFDs(msg)
+		if msg.Type == dbus.TypeMethodCall {
+			b.handleCall(c, msg)
+		}
+	case dest != "":
+		target := b.owner(dest)
+		if target == nil {
+			closeUnixFDs(msg)
+			if msg.Type == dbus.TypeMethodCall && msg.Flags&dbus.FlagNoReplyExpected == 0 {
+				c.enqueueOwn(b.errorReply(c, msg, "org.freedesktop.DBus.Error.ServiceUnknown",
+					"The name "+dest+" was not provided by any .service files"))
+			}
+			return
+		}
+		target.enqueue(msg, fdReleaser(msg, 1))
+	default:
+		b.broadcast(msg, c.name)
+	}
+}
+
+// broadcast sends msg, which was sent by sender, to all clients that have a
+// matching match rule. b.mu must be held.
+func (b *Bus) broadcast(msg *dbus.Message, sender string) {
+	var targets []*client
+	for _, c := range b.clients {
+		for _, m := range c.matches {
+			if m.matches(msg, sender, b.ownerName) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	if sender == busName {
+		// every client's connection sets its own serial
+		for _, c := range targets {
+			c.enqueueOwn(copyMessage(msg))
+		}
+		return
+	}
+	if len(targets) == 0 {
+		closeUnixFDs(msg)
+		return
+	}
+	release := fdReleaser(msg, len(targets))
+	for _, c := range targets {
+		c.enqueue(msg, release)
+	}
+}
+
+// disconnect removes c from the bus and releases all of its names.
+func (b *Bus) disconnect(c *client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.disconnected {
+		return
+	}
+	c.disconnected = true
+	delete(b.conns, c)
+	if c.name == "" {
+		return
+	}
+	delete(b.clients, c.name)
+	for s, n := range b.names {
+		if i := n.index(c); i != -1 {
+			b.releaseName(c, s)
+		}
+	}
+	b.ownerChanged(c.name, c, nil)
+}
+
+// hello assigns a unique name to c. b.mu must be held.
+func (b *Bus) hello(c *client) {
+	b.serial++
+	c.name = ":1." + strconv.FormatUint(b.serial, 10)
+	b.clients[c.name] = c
+}
+
+// signal creates a signal that is sent by the bus to dest (or broadcast, if
+// dest is empty).
+func (b *Bus) signal(dest, member string, body ...interface{}) *dbus.Message {
+	msg := &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:    dbus.MakeVariant(busName),
+			dbus.FieldPath:      dbus.MakeVariant(busPath),
+			dbus.FieldInterface: dbus.MakeVariant(busIface),
+			dbus.FieldMember:    dbus.MakeVariant(member),
+		},
+		Body: body,
+	}
+	if dest != "" {
+		msg.Headers[dbus.FieldDestination] = dbus.MakeVariant(dest)
+	}
+	if len(body) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(body...))
+	}
+	return msg
+}
+
+// reply creates a reply of the bus to the method call msg from c.
+func (b *Bus) reply(c *client, msg *dbus.Message, body ...interface{}) *dbus.Message {
+	reply := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:      dbus.MakeVariant(busName),
+			dbus.FieldDestination: dbus.MakeVariant(c.name),
+			dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+		},
+		Body: body,
+	}
+	if len(body) > 0 {
+		reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(body...))
+	}
+	return reply
+}
+
+// errorReply creates an error reply of the bus to the method call msg from c.
+func (b *Bus) errorReply(c *client, msg *dbus.Message, name, text string) *dbus.Message {
+	reply := b.reply(c, msg, text)
+	reply.Type = dbus.TypeError
+	reply.Headers[dbus.FieldErrorName] = dbus.MakeVariant(name)
+	return reply
+}
+
+// fdReleaser returns a function that closes the Unix FDs contained in msg
+// after it has been called n times, i.e. once the message has been sent to
+// all of its n receivers.
+func fdReleaser(msg *dbus.Message, n int) func() {
+	count := int32(n)
+	return func() {
+		if atomic.AddInt32(&count, -1) == 0 {
+			closeUnixFDs(msg)
+		}
+	}
+}
+
+// closeUnixFDs closes the file descriptors contained in the body of msg.
+// Receivers of a forwarded message get their own copies of the descriptors,
+// so those of the bus are not needed anymore.
+func closeUnixFDs(msg *dbus.Message) {
+	for _, v := range msg.Body {
+		switch fd := v.(type) {
+		case dbus.UnixFD:
+			os.NewFile(uintptr(fd), "").Close()
+		case []dbus.UnixFD:
+			for _, f := range fd {
+				os.NewFile(uintptr(f), "").Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package bus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+type busTest struct{}
+
+func (busTest) Double(n int64) (int64, *dbus.Error) {
+	return 2 * n, nil
+}
+
+func newTestBus(t *testing.T) (*Bus, string, func()) {
+	dir, err := ioutil.TempDir("", "dbus-bus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New()
+	addr, err := b.Listen("unix:path=" + filepath.Join(dir, "socket"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return b, addr, func() {
+		b.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func connect(t *testing.T, addr string) *dbus.Conn {
+	conn, err := dbus.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestBusCall(t *testing.T) {
+	_, addr, cleanup := newTestBus(t)
+	defer cleanup()
+	server := connect(t, addr)
+	defer server.Close()
+	client := connect(t, addr)
+	defer client.Close()
+
+	server.Export(busTest{}, "/org/guelfey/DBus/Test", "org.guelfey.DBus.Test")
+	reply, err := server.RequestName("org.guelfey.DBus.Test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName returned %v", reply)
+	}
+
+	var n int64
+	obj := client.Object("org.guelfey.DBus.Test", "/org/guelfey/DBus/Test")
+	if err = obj.Call("org.guelfey.DBus.Test.Double", 0, int64(2)).Store(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("Response was %d, expected 4", n)
+	}
+
+	var owner string
+	err = client.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, "org.guelfey.DBus.Test").Store(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != server.Names()[0] {
+		t.Errorf("GetNameOwner returned %q, expected %q", owner, server.Names()[0])
+	}
+
+	err = client.Object("org.guelfey.DBus.Missing", "/").Call("org.guelfey.DBus.Test.Double", 0, int64(2)).Err
+	if e, ok := err.(dbus.Error); !ok || e.Name != "org.freedesktop.DBus.Error.ServiceUnknown" {
+		t.Errorf("call to missing name returned %v", err)
+	}
+}
+
+func TestBusSignal(t *testing.T) {
+	_, addr, cleanup := newTestBus(t)
+	defer cleanup()
+	sender := connect(t, addr)
+	defer sender.Close()
+	receiver := connect(t, addr)
+	defer receiver.Close()
+
+	ch := make(chan *dbus.Signal, 10)
+	receiver.Signal(ch)
+	rule := "type='signal',interface='org.guelfey.DBus.Test',arg0='yes'"
+	if err := receiver.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err; err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"no", "yes"} {
+		if err := sender.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Ping", arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// skip the signals that the bus sent to the receiver
+	var sig *dbus.Signal
+	for sig == nil || sig.Sender == "org.freedesktop.DBus" {
+		select {
+		case sig = <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not received")
+		}
+	}
+	if sig.Name != "org.guelfey.DBus.Test.Ping" || sig.Body[0] != "yes" {
+		t.Errorf("unexpected signal %v", sig)
+	}
+	if sig.Sender != sender.Names()[0] {
+		t.Errorf("signal sender is %q, expected %q", sig.Sender, sender.Names()[0])
+	}
+
+	err := receiver.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, "type='error'").Err
+	if e, ok := err.(dbus.Error); !ok || e.Name != "org.freedesktop.DBus.Error.MatchRuleNotFound" {
+		t.Errorf("RemoveMatch returned %v", err)
+	}
+}
+
+func TestBusNameQueue(t *testing.T) {
+	_, addr, cleanup := newTestBus(t)
+	defer cleanup()
+	first := connect(t, addr)
+	defer first.Close()
+	second := connect(t, addr)
+	defer second.Close()
+
+	const name = "org.guelfey.DBus.Queue"
+	reply, err := first.RequestName(name, dbus.NameFlagAllowReplacement)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName returned %v, %v", reply, err)
+	}
+	reply, err = second.RequestName(name, 0)
+	if err != nil || reply != dbus.RequestNameReplyInQueue {
+		t.Fatalf("RequestName returned %v, %v", reply, err)
+	}
+	reply, err = second.RequestName(name, dbus.NameFlagReplaceExisting)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName returned %v, %v", reply, err)
+	}
+
+	var owners []string
+	err = first.BusObject().Call("org.freedesktop.DBus.ListQueuedOwners", 0, name).Store(&owners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 2 || owners[0] != second.Names()[0] || owners[1] != first.Names()[0] {
+		t.Errorf("ListQueuedOwners returned %v", owners)
+	}
+
+	// the name goes back to the first connection when the second one closes
+	second.Close()
+	var owner string
+	for i := 0; i < 50; i++ {
+		err = first.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner)
+		if err == nil && owner == first.Names()[0] {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("name not transferred back: %q, %v", owner, err)
+}
+
+func TestParseMatchRule(t *testing.T) {
+	valid := []string{
+		"",
+		"type='signal'",
+		"type='signal',sender='org.freedesktop.DBus',member='NameOwnerChanged',arg0='org.example'",
+		"path_namespace='/org/example',arg1path='/a/'",
+		"arg0='it'\\''s'",
+	}
+	for _, rule := range valid {
+		if _, err := parseMatchRule(rule); err != nil {
+			t.Errorf("parseMatchRule(%q): %v", rule, err)
+		}
+	}
+	invalid := []string{
+		"type='foo'",
+		"type='signal',type='signal'",
+		"path='/a',path_namespace='/b'",
+		"arg64='x'",
+		"member='unterminated",
+		"foo='bar'",
+	}
+	for _, rule := range invalid {
+		if _, err := parseMatchRule(rule); err == nil {
+			t.Errorf("parseMatchRule(%q) succeeded", rule)
+		}
+	}
+}
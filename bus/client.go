@@ -0,0 +1,136 @@
+package bus
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// outgoing is a message in the queue of a client.
+type outgoing struct {
+	msg *dbus.Message
+
+	// own is true for messages that originate from the bus itself and
+	// therefore need a new serial.
+	own bool
+
+	// release is called after a forwarded message has been sent.
+	release func()
+}
+
+// client is a connection to the bus.
+type client struct {
+	bus  *Bus
+	conn *dbus.Conn
+
+	// the following fields are protected by bus.mu
+	name         string
+	matches      []*matchRule
+	disconnected bool
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []outgoing
+	closed bool
+}
+
+func newClient(b *Bus, conn *dbus.Conn) *client {
+	c := &client{bus: b, conn: conn}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// readLoop runs in an own goroutine, reading messages from the client and
+// routing them.
+func (c *client) readLoop() {
+	for {
+		msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if _, ok := err.(dbus.InvalidMessageError); ok {
+				continue
+			}
+			break
+		}
+		c.bus.route(c, msg)
+	}
+	c.conn.Close()
+	c.bus.disconnect(c)
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Signal()
+	c.mu.Unlock()
+}
+
+// writeLoop runs in an own goroutine, sending the queued messages to the
+// client.
+func (c *client) writeLoop() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if c.closed {
+			queue := c.queue
+			c.queue = nil
+			c.mu.Unlock()
+			for _, out := range queue {
+				if out.release != nil {
+					out.release()
+				}
+			}
+			return
+		}
+		out := c.queue[0]
+		c.queue[0] = outgoing{}
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		var err error
+		if out.own {
+			err = c.conn.Send(out.msg, nil).Err
+		} else {
+			err = c.conn.SendMessage(out.msg)
+			out.release()
+		}
+		if err != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+// enqueueOwn queues a message that originates from the bus.
+func (c *client) enqueueOwn(msg *dbus.Message) {
+	c.push(outgoing{msg: msg, own: true})
+}
+
+// enqueue queues a message that is forwarded from another client. The
+// message is copied, so that it can be queued for multiple clients. release
+// is called once the message has been sent (or dropped).
+func (c *client) enqueue(msg *dbus.Message, release func()) {
+	c.push(outgoing{msg: copyMessage(msg), release: release})
+}
+
+// copyMessage returns a copy of msg that can be sent independently of it,
+// as sending sets the serial of the message.
+func copyMessage(msg *dbus.Message) *dbus.Message {
+	cp := *msg
+	cp.Headers = make(map[dbus.HeaderField]dbus.Variant, len(msg.Headers))
+	for k, v := range msg.Headers {
+		cp.Headers[k] = v
+	}
+	cp.Body = append([]interface{}(nil), msg.Body...)
+	return &cp
+}
+
+func (c *client) push(out outgoing) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		if out.release != nil {
+			out.release()
+		}
+		return
+	}
+	c.queue = append(c.queue, out)
+	c.cond.Signal()
+}
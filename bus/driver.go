@@ -0,0 +1,265 @@
+package bus
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+)
+
+const (
+	errInvalidArgs       = "org.freedesktop.DBus.Error.InvalidArgs"
+	errNameHasNoOwner    = "org.freedesktop.DBus.Error.NameHasNoOwner"
+	errMatchRuleInvalid  = "org.freedesktop.DBus.Error.MatchRuleInvalid"
+	errMatchRuleNotFound = "org.freedesktop.DBus.Error.MatchRuleNotFound"
+	errUnknownMethod     = "org.freedesktop.DBus.Error.UnknownMethod"
+	errUnixProcessID     = "org.freedesktop.DBus.Error.UnixProcessIdUnknown"
+	errFailed            = "org.freedesktop.DBus.Error.Failed"
+	errServiceUnknown    = "org.freedesktop.DBus.Error.ServiceUnknown"
+)
+
+// startReplyAlreadyRunning is the reply to StartServiceByName if the service
+// is already running.
+const startReplyAlreadyRunning uint32 = 2
+
+// introspectData describes the interfaces implemented by the bus.
+var introspectData = &introspect.Node{
+	Interfaces: []introspect.Interface{
+		{
+			Name: busIface,
+			Methods: []introspect.Method{
+				{Name: "Hello", Args: []introspect.Arg{arg("", "s", "out")}},
+				{Name: "RequestName", Args: []introspect.Arg{arg("", "s", "in"), arg("", "u", "in"), arg("", "u", "out")}},
+				{Name: "ReleaseName", Args: []introspect.Arg{arg("", "s", "in"), arg("", "u", "out")}},
+				{Name: "StartServiceByName", Args: []introspect.Arg{arg("", "s", "in"), arg("", "u", "in"), arg("", "u", "out")}},
+				{Name: "NameHasOwner", Args: []introspect.Arg{arg("", "s", "in"), arg("", "b", "out")}},
+				{Name: "ListNames", Args: []introspect.Arg{arg("", "as", "out")}},
+				{Name: "ListActivatableNames", Args: []introspect.Arg{arg("", "as", "out")}},
+				{Name: "AddMatch", Args: []introspect.Arg{arg("", "s", "in")}},
+				{Name: "RemoveMatch", Args: []introspect.Arg{arg("", "s", "in")}},
+				{Name: "GetNameOwner", Args: []introspect.Arg{arg("", "s", "in"), arg("", "s", "out")}},
+				{Name: "ListQueuedOwners", Args: []introspect.Arg{arg("", "s", "in"), arg("", "as", "out")}},
+				{Name: "GetConnectionUnixUser", Args: []introspect.Arg{arg("", "s", "in"), arg("", "u", "out")}},
+				{Name: "GetConnectionUnixProcessID", Args: []introspect.Arg{arg("", "s", "in"), arg("", "u", "out")}},
+				{Name: "GetConnectionCredentials", Args: []introspect.Arg{arg("", "s", "in"), arg("", "a{sv}", "out")}},
+				{Name: "GetId", Args: []introspect.Arg{arg("", "s", "out")}},
+			},
+			Signals: []introspect.Signal{
+				{Name: "NameOwnerChanged", Args: []introspect.Arg{arg("", "s", ""), arg("", "s", ""), arg("", "s", "")}},
+				{Name: "NameLost", Args: []introspect.Arg{arg("", "s", "")}},
+				{Name: "NameAcquired", Args: []introspect.Arg{arg("", "s", "")}},
+			},
+		},
+		introspect.IntrospectData,
+		{
+			Name: "org.freedesktop.DBus.Peer",
+			Methods: []introspect.Method{
+				{Name: "Ping"},
+				{Name: "GetMachineId", Args: []introspect.Arg{arg("machine_uuid", "s", "out")}},
+			},
+		},
+	},
+}
+
+func arg(name, typ, direction string) introspect.Arg {
+	return introspect.Arg{Name: name, Type: typ, Direction: direction}
+}
+
+// handleCall handles a method call from c to the bus itself. b.mu must be
+// held.
+func (b *Bus) handleCall(c *client, msg *dbus.Message) {
+	iface := headerString(msg, dbus.FieldInterface)
+	member := headerString(msg, dbus.FieldMember)
+	var (
+		body []interface{}
+		err  *dbus.Error
+	)
+	switch iface {
+	case "", busIface:
+		body, err = b.handleBusCall(c, member, msg)
+	case "org.freedesktop.DBus.Introspectable":
+		if member != "Introspect" {
+			err = dbus.NewError(errUnknownMethod, []interface{}{"Unknown method " + member})
+			break
+		}
+		data, _ := xml.Marshal(introspectData)
+		body = []interface{}{strings.TrimSpace(introspect.IntrospectDeclarationString) + string(data)}
+	case "org.freedesktop.DBus.Peer":
+		switch member {
+		case "Ping":
+		case "GetMachineId":
+			body = []interface{}{b.machineID()}
+		default:
+			err = dbus.NewError(errUnknownMethod, []interface{}{"Unknown method " + member})
+		}
+	default:
+		err = dbus.NewError(errUnknownMethod, []interface{}{"Unknown interface " + iface})
+	}
+	if msg.Flags&dbus.FlagNoReplyExpected != 0 {
+		return
+	}
+	if err != nil {
+		text, _ := err.Body[0].(string)
+		c.enqueueOwn(b.errorReply(c, msg, err.Name, text))
+		return
+	}
+	c.enqueueOwn(b.reply(c, msg, body...))
+	if member == "Hello" {
+		// the unique name is announced after the reply to Hello
+		b.ownerChanged(c.name, nil, c)
+	}
+}
+
+// handleBusCall implements the methods of the org.freedesktop.DBus
+// interface. b.mu must be held.
+func (b *Bus) handleBusCall(c *client, member string, msg *dbus.Message) ([]interface{}, *dbus.Error) {
+	var (
+		s     string
+		flags uint32
+	)
+	invalidArgs := dbus.NewError(errInvalidArgs, []interface{}{"Invalid arguments for " + member})
+	switch member {
+	case "Hello":
+		if c.name != "" {
+			return nil, dbus.NewError(errFailed, []interface{}{"Already handled an Hello message"})
+		}
+		b.hello(c)
+		return []interface{}{c.name}, nil
+	case "RequestName":
+		if dbus.Store(msg.Body, &s, &flags) != nil {
+			return nil, invalidArgs
+		}
+		if !isValidBusName(s) || s == busName {
+			return nil, dbus.NewError(errInvalidArgs, []interface{}{"Cannot acquire the name " + s})
+		}
+		return []interface{}{uint32(b.requestName(c, s, dbus.RequestNameFlags(flags)))}, nil
+	case "ReleaseName":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		if !isValidBusName(s) || s == busName {
+			return nil, dbus.NewError(errInvalidArgs, []interface{}{"Cannot release the name " + s})
+		}
+		return []interface{}{uint32(b.releaseName(c, s))}, nil
+	case "StartServiceByName":
+		if dbus.Store(msg.Body, &s, &flags) != nil {
+			return nil, invalidArgs
+		}
+		if b.ownerName(s) == "" {
+			return nil, dbus.NewError(errServiceUnknown, []interface{}{"The name " + s + " was not provided by any .service files"})
+		}
+		return []interface{}{startReplyAlreadyRunning}, nil
+	case "NameHasOwner":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		return []interface{}{b.ownerName(s) != ""}, nil
+	case "ListNames":
+		names := []string{busName}
+		for name := range b.clients {
+			names = append(names, name)
+		}
+		for name := range b.names {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+		return []interface{}{names}, nil
+	case "ListActivatableNames":
+		return []interface{}{[]string{busName}}, nil
+	case "AddMatch":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		m, err := parseMatchRule(s)
+		if err != nil {
+			return nil, dbus.NewError(errMatchRuleInvalid, []interface{}{"Invalid match rule " + s})
+		}
+		c.matches = append(c.matches, m)
+		return nil, nil
+	case "RemoveMatch":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		if _, err := parseMatchRule(s); err != nil {
+			return nil, dbus.NewError(errMatchRuleInvalid, []interface{}{"Invalid match rule " + s})
+		}
+		for i, m := range c.matches {
+			if m.rule == s {
+				c.matches = append(c.matches[:i], c.matches[i+1:]...)
+				return nil, nil
+			}
+		}
+		return nil, dbus.NewError(errMatchRuleNotFound, []interface{}{"The given match rule wasn't found"})
+	case "GetNameOwner":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		owner := b.ownerName(s)
+		if owner == "" {
+			return nil, dbus.NewError(errNameHasNoOwner, []interface{}{"Could not get owner of name '" + s + "': no such name"})
+		}
+		return []interface{}{owner}, nil
+	case "ListQueuedOwners":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		if s == busName {
+			return []interface{}{[]string{busName}}, nil
+		}
+		if t, ok := b.clients[s]; ok {
+			return []interface{}{[]string{t.name}}, nil
+		}
+		n, ok := b.names[s]
+		if !ok {
+			return nil, dbus.NewError(errNameHasNoOwner, []interface{}{"Could not get owners of name '" + s + "': no such name"})
+		}
+		owners := make([]string, 0, len(n.queue))
+		for _, r := range n.queue {
+			owners = append(owners, r.client.name)
+		}
+		return []interface{}{owners}, nil
+	case "GetConnectionUnixUser", "GetConnectionUnixProcessID", "GetConnectionCredentials":
+		if dbus.Store(msg.Body, &s) != nil {
+			return nil, invalidArgs
+		}
+		t := b.owner(s)
+		if t == nil {
+			return nil, dbus.NewError(errNameHasNoOwner, []interface{}{"Could not get credentials of name '" + s + "': no such name"})
+		}
+		creds := t.conn.PeerCredentials()
+		switch {
+		case member == "GetConnectionCredentials":
+			m := make(map[string]dbus.Variant)
+			if creds != nil {
+				m["UnixUserID"] = dbus.MakeVariant(creds.Uid)
+				m["ProcessID"] = dbus.MakeVariant(creds.Pid)
+			}
+			return []interface{}{m}, nil
+		case creds == nil && member == "GetConnectionUnixUser":
+			return nil, dbus.NewError(errFailed, []interface{}{"Could not determine the user of " + s})
+		case creds == nil:
+			return nil, dbus.NewError(errUnixProcessID, []interface{}{"Could not determine the process id of " + s})
+		case member == "GetConnectionUnixUser":
+			return []interface{}{creds.Uid}, nil
+		default:
+			return []interface{}{creds.Pid}, nil
+		}
+	case "GetId":
+		return []interface{}{b.id}, nil
+	}
+	return nil, dbus.NewError(errUnknownMethod, []interface{}{"Unknown method " + member})
+}
+
+// machineID returns the id of the local machine or, if it can't be
+// determined, the id of the bus.
+func (b *Bus) machineID() string {
+	for _, name := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id, err := ioutil.ReadFile(name); err == nil {
+			return strings.TrimSpace(string(id))
+		}
+	}
+	return b.id
+}
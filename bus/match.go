@@ -0,0 +1,246 @@
+package bus
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// errInvalidMatchRule is returned by parseMatchRule for rules that don't
+// follow the syntax described in the specification.
+var errInvalidMatchRule = errors.New("invalid match rule")
+
+// maxMatchArgs is the number of arguments that can be matched with argN.
+const maxMatchArgs = 64
+
+// matchArg is an argN, argNpath or arg0namespace condition.
+type matchArg struct {
+	index int
+	value string
+	kind  string // "", "path" or "namespace"
+}
+
+// matchRule is a parsed match rule as passed to AddMatch.
+type matchRule struct {
+	rule          string
+	typ           dbus.Type
+	sender        string
+	iface         string
+	member        string
+	path          dbus.ObjectPath
+	pathNamespace dbus.ObjectPath
+	destination   string
+	args          []matchArg
+}
+
+// parseMatchRule parses a match rule string.
+func parseMatchRule(rule string) (*matchRule, error) {
+	m := &matchRule{rule: rule}
+	seen := make(map[string]bool)
+	s := rule
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, errInvalidMatchRule
+		}
+		key := strings.TrimSpace(s[:i])
+		value, rest, err := parseMatchValue(s[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		s = strings.TrimLeft(rest, " ")
+		if len(s) > 0 {
+			if s[0] != ',' {
+				return nil, errInvalidMatchRule
+			}
+			s = s[1:]
+		}
+		if seen[key] {
+			return nil, errInvalidMatchRule
+		}
+		seen[key] = true
+		if err := m.set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if m.path != "" && m.pathNamespace != "" {
+		return nil, errInvalidMatchRule
+	}
+	return m, nil
+}
+
+// parseMatchValue parses the value of a key in a match rule and returns the
+// remaining part of the rule. Apostrophes are quoting characters and a
+// backslash outside of them escapes an apostrophe.
+func parseMatchValue(s string) (string, string, error) {
+	var (
+		value  []byte
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+			value = append(value, c)
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\'':
+			value = append(value, '\'')
+			i++
+		case c == ',':
+			return string(value), s[i:], nil
+		default:
+			value = append(value, c)
+		}
+	}
+	if quoted {
+		return "", "", errInvalidMatchRule
+	}
+	return string(value), "", nil
+}
+
+func (m *matchRule) set(key, value string) error {
+	switch key {
+	case "type":
+		switch value {
+		case "signal":
+			m.typ = dbus.TypeSignal
+		case "method_call":
+			m.typ = dbus.TypeMethodCall
+		case "method_return":
+			m.typ = dbus.TypeMethodReply
+		case "error":
+			m.typ = dbus.TypeError
+		default:
+			return errInvalidMatchRule
+		}
+	case "sender":
+		m.sender = value
+	case "interface":
+		m.iface = value
+	case "member":
+		m.member = value
+	case "path":
+		if !dbus.ObjectPath(value).IsValid() {
+			return errInvalidMatchRule
+		}
+		m.path = dbus.ObjectPath(value)
+	case "path_namespace":
+		if !dbus.ObjectPath(value).IsValid() {
+			return errInvalidMatchRule
+		}
+		m.pathNamespace = dbus.ObjectPath(value)
+	case "destination":
+		m.destination = value
+	case "eavesdrop":
+		// eavesdropping is not supported; such rules only match messages
+		// that would be delivered anyway.
+	case "arg0namespace":
+		m.args = append(m.args, matchArg{0, value, "namespace"})
+	default:
+		if !strings.HasPrefix(key, "arg") {
+			return errInvalidMatchRule
+		}
+		n := key[3:]
+		kind := ""
+		if strings.HasSuffix(n, "path") {
+			n = n[:len(n)-4]
+			kind = "path"
+		}
+		i, err := strconv.Atoi(n)
+		if err != nil || i < 0 || i >= maxMatchArgs || strconv.Itoa(i) != n {
+			return errInvalidMatchRule
+		}
+		m.args = append(m.args, matchArg{i, value, kind})
+	}
+	return nil
+}
+
+// matches returns whether msg, which was sent by the client with the unique
+// name sender, matches the rule. owner is used to look up the unique name of
+// the owner of a well-known name.
+func (m *matchRule) matches(msg *dbus.Message, sender string, owner func(string) string) bool {
+	if m.typ != 0 && m.typ != msg.Type {
+		return false
+	}
+	if m.sender != "" && m.sender != sender {
+		if strings.HasPrefix(m.sender, ":") || owner(m.sender) != sender {
+			return false
+		}
+	}
+	if m.iface != "" && m.iface != headerString(msg, dbus.FieldInterface) {
+		return false
+	}
+	if m.member != "" && m.member != headerString(msg, dbus.FieldMember) {
+		return false
+	}
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	if m.path != "" && m.path != path {
+		return false
+	}
+	if m.pathNamespace != "" && !inPathNamespace(path, m.pathNamespace) {
+		return false
+	}
+	if m.destination != "" && m.destination != headerString(msg, dbus.FieldDestination) {
+		return false
+	}
+	for _, arg := range m.args {
+		if arg.index >= len(msg.Body) {
+			return false
+		}
+		var s string
+		switch v := msg.Body[arg.index].(type) {
+		case string:
+			s = v
+		case dbus.ObjectPath:
+			if arg.kind != "path" {
+				return false
+			}
+			s = string(v)
+		default:
+			return false
+		}
+		switch arg.kind {
+		case "":
+			if s != arg.value {
+				return false
+			}
+		case "path":
+			if !argPathMatches(s, arg.value) {
+				return false
+			}
+		case "namespace":
+			if s != arg.value && !strings.HasPrefix(s, arg.value+".") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// inPathNamespace returns whether path is ns or one of its descendants.
+func inPathNamespace(path, ns dbus.ObjectPath) bool {
+	if ns == "/" || path == ns {
+		return true
+	}
+	return strings.HasPrefix(string(path), string(ns)+"/")
+}
+
+// argPathMatches implements the comparison of argNpath: the values are equal
+// or one of them ends with a slash and is a prefix of the other.
+func argPathMatches(s, value string) bool {
+	if s == value {
+		return true
+	}
+	if strings.HasSuffix(value, "/") && strings.HasPrefix(s, value) {
+		return true
+	}
+	return strings.HasSuffix(s, "/") && strings.HasPrefix(value, s)
+}
+
+func headerString(msg *dbus.Message, field dbus.HeaderField) string {
+	s, _ := msg.Headers[field].Value().(string)
+	return s
+}
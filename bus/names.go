@@ -0,0 +1,167 @@
+package bus
+
+import (
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// nameRequest is an entry in the queue of a well-known name.
+type nameRequest struct {
+	client *client
+	flags  dbus.RequestNameFlags
+}
+
+// name tracks the owner and the queue of a well-known name. The first entry
+// of queue is the primary owner.
+type name struct {
+	queue []nameRequest
+}
+
+func (n *name) owner() *client {
+	return n.queue[0].client
+}
+
+func (n *name) index(c *client) int {
+	for i, r := range n.queue {
+		if r.client == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *name) remove(i int) {
+	n.queue = append(n.queue[:i], n.queue[i+1:]...)
+}
+
+// requestName implements org.freedesktop.DBus.RequestName. b.mu must be held.
+func (b *Bus) requestName(c *client, s string, flags dbus.RequestNameFlags) dbus.RequestNameReply {
+	n, ok := b.names[s]
+	if !ok {
+		b.names[s] = &name{queue: []nameRequest{{c, flags}}}
+		b.ownerChanged(s, nil, c)
+		return dbus.RequestNameReplyPrimaryOwner
+	}
+	i := n.index(c)
+	if i == 0 {
+		n.queue[0].flags = flags
+		return dbus.RequestNameReplyAlreadyOwner
+	}
+	owner := n.queue[0]
+	if owner.flags&dbus.NameFlagAllowReplacement != 0 && flags&dbus.NameFlagReplaceExisting != 0 {
+		if i > 0 {
+			n.remove(i)
+		}
+		rest := n.queue[1:]
+		if owner.flags&dbus.NameFlagDoNotQueue == 0 {
+			// the previous owner moves to the head of the queue
+			rest = append([]nameRequest{owner}, rest...)
+		}
+		n.queue = append([]nameRequest{{c, flags}}, rest...)
+		b.ownerChanged(s, owner.client, c)
+		return dbus.RequestNameReplyPrimaryOwner
+	}
+	if flags&dbus.NameFlagDoNotQueue != 0 {
+		if i > 0 {
+			n.remove(i)
+		}
+		return dbus.RequestNameReplyExists
+	}
+	if i > 0 {
+		n.queue[i].flags = flags
+	} else {
+		n.queue = append(n.queue, nameRequest{c, flags})
+	}
+	return dbus.RequestNameReplyInQueue
+}
+
+// releaseName implements org.freedesktop.DBus.ReleaseName. b.mu must be held.
+func (b *Bus) releaseName(c *client, s string) dbus.ReleaseNameReply {
+	n, ok := b.names[s]
+	if !ok {
+		return dbus.ReleaseNameReplyNonExistent
+	}
+	i := n.index(c)
+	switch {
+	case i == -1:
+		return dbus.ReleaseNameReplyNotOwner
+	case i > 0:
+		n.remove(i)
+	default:
+		n.remove(0)
+		if len(n.queue) == 0 {
+			delete(b.names, s)
+			b.ownerChanged(s, c, nil)
+		} else {
+			b.ownerChanged(s, c, n.owner())
+		}
+	}
+	return dbus.ReleaseNameReplyReleased
+}
+
+// ownerChanged emits the signals for a change of the primary owner of a
+// well-known name. b.mu must be held.
+func (b *Bus) ownerChanged(s string, old, new *client) {
+	var oldName, newName string
+	if old != nil {
+		oldName = old.name
+		if !old.disconnected {
+			old.enqueueOwn(b.signal(old.name, "NameLost", s))
+		}
+	}
+	if new != nil {
+		newName = new.name
+	}
+	b.broadcast(b.signal("", "NameOwnerChanged", s, oldName, newName), busName)
+	if new != nil {
+		new.enqueueOwn(b.signal(new.name, "NameAcquired", s))
+	}
+}
+
+// owner returns the client that owns the given (unique or well-known) name
+// or nil. b.mu must be held.
+func (b *Bus) owner(s string) *client {
+	if strings.HasPrefix(s, ":") {
+		return b.clients[s]
+	}
+	if n, ok := b.names[s]; ok {
+		return n.owner()
+	}
+	return nil
+}
+
+// ownerName works like owner, but returns the unique name of the owner or ""
+// if there is none. b.mu must be held.
+func (b *Bus) ownerName(s string) string {
+	if s == busName {
+		return busName
+	}
+	if c := b.owner(s); c != nil {
+		return c.name
+	}
+	return ""
+}
+
+// isValidBusName returns whether s is a valid well-known bus name.
+func isValidBusName(s string) bool {
+	if len(s) == 0 || len(s) > 255 || s[0] == '.' || s[0] == ':' {
+		return false
+	}
+	elems := strings.Split(s, ".")
+	if len(elems) < 2 {
+		return false
+	}
+	for _, elem := range elems {
+		if len(elem) == 0 || ('0' <= elem[0] && elem[0] <= '9') {
+			return false
+		}
+		for _, c := range elem {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+				'0' <= c && c <= '9' || c == '_' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
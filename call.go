@@ -27,6 +27,9 @@ type Call struct {
 	// tracks context and canceler
 	ctx         context.Context
 	ctxCanceler context.CancelFunc
+
+	// observe is called when the call is done, see Conn.observeCall.
+	observe func(call *Call)
 }
 
 func (c *Call) Context() context.Context {
@@ -55,6 +58,9 @@ func (c *Call) Store(retvalues ...interface{}) error {
 }
 
 func (c *Call) done() {
+	if c.observe != nil {
+		c.observe(c)
+	}
 	c.Done <- c
 	c.ContextCancel()
 }
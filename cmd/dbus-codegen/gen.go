@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/introspect"
+)
+
+const (
+	propertiesIface   = "org.freedesktop.DBus.Properties"
+	noReplyAnnotation = "org.freedesktop.DBus.Method.NoReply"
+)
+
+// standardInterfaces are skipped unless they are requested explicitly, as
+// they are implemented by the dbus package itself.
+var standardInterfaces = map[string]bool{
+	"org.freedesktop.DBus.Introspectable": true,
+	"org.freedesktop.DBus.Peer":           true,
+	"org.freedesktop.DBus.Properties":     true,
+	"org.freedesktop.DBus.ObjectManager":  true,
+}
+
+// options controls which code is generated.
+type options struct {
+	Package string
+	Client  bool
+	Server  bool
+}
+
+// param is a Go parameter for a D-Bus argument.
+type param struct {
+	name string
+	typ  string
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	opts  options
+	iface string // the interface that is generated
+
+	// the standard packages are only imported if they are used
+	usesContext bool
+	usesFmt     bool
+
+	// the package-level identifiers that were declared
+	declared map[string]bool
+}
+
+// generate returns the formatted Go source for the given interfaces.
+func generate(interfaces []introspect.Interface, opts options) ([]byte, error) {
+	g := &generator{opts: opts, declared: make(map[string]bool)}
+	names := goNames(interfaces)
+	for _, iface := range interfaces {
+		if err := g.writeInterface(iface, names[iface.Name]); err != nil {
+			return nil, fmt.Errorf("%s: %v", iface.Name, err)
+		}
+	}
+	var src bytes.Buffer
+	src.WriteString("// Code generated by dbus-codegen. DO NOT EDIT.\n\n")
+	src.WriteString("package " + opts.Package + "\n\nimport (\n")
+	if g.usesContext {
+		src.WriteString("\"context\"\n")
+	}
+	if g.usesFmt {
+		src.WriteString("\"fmt\"\n")
+	}
+	src.WriteString("\n\"github.com/godbus/dbus\"\n)\n")
+	src.Write(g.buf.Bytes())
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return out, nil
+}
+
+// goNames returns the Go names of the given interfaces. The last element of
+// the interface name is used unless it isn't unique, in which case all
+// elements are joined.
+func goNames(interfaces []introspect.Interface) map[string]string {
+	count := make(map[string]int)
+	for _, iface := range interfaces {
+		count[shortName(iface.Name)]++
+	}
+	names := make(map[string]string, len(interfaces))
+	for _, iface := range interfaces {
+		name := shortName(iface.Name)
+		if count[name] > 1 {
+			name = ""
+			for _, s := range strings.Split(iface.Name, ".") {
+				name += exportedName(s)
+			}
+		}
+		names[iface.Name] = name
+	}
+	return names
+}
+
+func shortName(iface string) string {
+	return exportedName(iface[strings.LastIndex(iface, ".")+1:])
+}
+
+// declare records the package-level identifiers that are about to be
+// generated. It fails if one of them was already declared, e.g. for another
+// interface.
+func (g *generator) declare(idents ...string) error {
+	for _, ident := range idents {
+		if g.declared[ident] {
+			return fmt.Errorf("%s is declared more than once in the generated code", ident)
+		}
+		g.declared[ident] = true
+	}
+	return nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) writeInterface(iface introspect.Interface, name string) error {
+	g.iface = iface.Name
+	if err := g.declare(name + "Interface"); err != nil {
+		return err
+	}
+	g.printf("\n// %sInterface is the name of the D-Bus interface %s.\n", name, iface.Name)
+	g.printf("const %sInterface = %q\n", name, iface.Name)
+	if g.opts.Client {
+		if err := g.writeClient(iface, name); err != nil {
+			return err
+		}
+	}
+	if g.opts.Server {
+		if err := g.writeServer(iface, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) writeClient(iface introspect.Interface, name string) error {
+	if err := g.declare(name, "New"+name); err != nil {
+		return err
+	}
+	g.printf("\n// %s is a client for the interface %s of a remote object.\n", name, iface.Name)
+	g.printf("type %s struct {\nobj dbus.BusObject\n}\n\n", name)
+	g.printf("// New%s returns a client for the interface %s of obj.\n", name, iface.Name)
+	g.printf("func New%[1]s(obj dbus.BusObject) *%[1]s {\nreturn &%[1]s{obj}\n}\n\n", name)
+	g.printf("// Object returns the object the client calls.\n")
+	g.printf("func (o *%s) Object() dbus.BusObject {\nreturn o.obj\n}\n", name)
+
+	// the Go methods of the client, which get a suffix if their names
+	// collide
+	used := map[string]bool{"Object": true}
+	for _, m := range iface.Methods {
+		if err := g.writeClientMethod(name, m, uniqueName(exportedName(m.Name), "Method", used)); err != nil {
+			return err
+		}
+	}
+	for _, p := range iface.Properties {
+		if err := g.writeClientProperty(name, p, used); err != nil {
+			return err
+		}
+	}
+	signals := signalNames(iface)
+	for i, s := range iface.Signals {
+		subscribe := uniqueName("Subscribe"+signals[i], "Signal", used)
+		if err := g.writeClientSignal(name, s, signals[i], subscribe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueName returns name, or name with suffix (and underscores) if it is
+// already in used, and adds the result to used.
+func uniqueName(name, suffix string, used map[string]bool) string {
+	if used[name] {
+		name += suffix
+	}
+	for used[name] {
+		name += "_"
+	}
+	used[name] = true
+	return name
+}
+
+// methodNames returns the Go names of the methods of iface.
+func methodNames(iface introspect.Interface) []string {
+	used := make(map[string]bool)
+	names := make([]string, len(iface.Methods))
+	for i, m := range iface.Methods {
+		names[i] = uniqueName(exportedName(m.Name), "Method", used)
+	}
+	return names
+}
+
+// signalNames returns the Go names of the signals of iface.
+func signalNames(iface introspect.Interface) []string {
+	used := make(map[string]bool)
+	names := make([]string, len(iface.Signals))
+	for i, s := range iface.Signals {
+		names[i] = uniqueName(exportedName(s.Name), "Signal", used)
+	}
+	return names
+}
+
+func (g *generator) writeClientMethod(name string, m introspect.Method, goName string) error {
+	used := make(map[string]bool)
+	in, err := params(methodArgs(m, "in"), "arg", localName, used)
+	if err != nil {
+		return fmt.Errorf("method %s: %v", m.Name, err)
+	}
+	out, err := params(methodArgs(m, "out"), "out", localName, used)
+	if err != nil {
+		return fmt.Errorf("method %s: %v", m.Name, err)
+	}
+	g.usesContext = true
+	g.printf("\n// %s calls the method %s.\n", goName, g.member(m.Name))
+	g.printf("func (o *%s) %s(ctx context.Context%s) (%serr error) {\n",
+		name, goName, joinParams(in, true, true), joinParams(out, false, true))
+	args := make([]string, 0, len(in))
+	for _, p := range in {
+		args = append(args, ", "+p.name)
+	}
+	call := fmt.Sprintf("o.obj.CallWithContext(ctx, %sInterface+%q, %%s%s)", name, "."+m.Name, strings.Join(args, ""))
+	switch {
+	case hasAnnotation(m.Annotations, noReplyAnnotation) && len(out) == 0:
+		g.printf("return "+call+".Err\n", "dbus.FlagNoReplyExpected")
+	case len(out) == 0:
+		g.printf("return "+call+".Err\n", "0")
+	default:
+		ptrs := make([]string, 0, len(out))
+		for _, p := range out {
+			ptrs = append(ptrs, "&"+p.name)
+		}
+		g.printf("err = "+call+".Store(%s)\n", "0", strings.Join(ptrs, ", "))
+		g.printf("return\n")
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func (g *generator) writeClientProperty(name string, p introspect.Property, used map[string]bool) error {
+	typ, err := goType(p.Type)
+	if err != nil {
+		return fmt.Errorf("property %s: %v", p.Name, err)
+	}
+	g.usesContext = true
+	goName := exportedName(p.Name)
+	getter, setter := "Get"+goName, "Set"+goName
+	if used[getter] || used[setter] {
+		getter, setter = getter+"Property", setter+"Property"
+	}
+	for used[getter] || used[setter] {
+		getter, setter = getter+"_", setter+"_"
+	}
+	used[getter], used[setter] = true, true
+	if p.Access == "read" || p.Access == "readwrite" {
+		g.printf("\n// %s returns the value of the property %s.\n", getter, g.member(p.Name))
+		g.printf("func (o *%s) %s(ctx context.Context) (v %s, err error) {\n", name, getter, typ)
+		g.printf("var variant dbus.Variant\n")
+		g.printf("err = o.obj.CallWithContext(ctx, %q, 0, %sInterface, %q).Store(&variant)\n",
+			propertiesIface+".Get", name, p.Name)
+		g.printf("if err == nil {\nerr = dbus.Store([]interface{}{variant.Value()}, &v)\n}\n")
+		g.printf("return\n}\n")
+	}
+	if p.Access == "write" || p.Access == "readwrite" {
+		g.printf("\n// %s sets the value of the property %s.\n", setter, g.member(p.Name))
+		g.printf("func (o *%s) %s(ctx context.Context, v %s) error {\n", name, setter, typ)
+		g.printf("return o.obj.CallWithContext(ctx, %q, 0, %sInterface, %q, dbus.MakeVariant(v)).Err\n}\n",
+			propertiesIface+".Set", name, p.Name)
+	}
+	return nil
+}
+
+func (g *generator) writeClientSignal(name string, s introspect.Signal, goName, subscribe string) error {
+	used := map[string]bool{"Sender": true, "Path": true}
+	fields, err := params(s.Args, "Arg", exportedName, used)
+	if err != nil {
+		return fmt.Errorf("signal %s: %v", s.Name, err)
+	}
+	g.usesFmt = true
+	typeName := name + goName + "Signal"
+	if err := g.declare(typeName, "Parse"+typeName); err != nil {
+		return err
+	}
+	g.printf("\n// %s holds the arguments of the signal %s.\n", typeName, g.member(s.Name))
+	g.printf("type %s struct {\nSender string\nPath dbus.ObjectPath\n", typeName)
+	for _, f := range fields {
+		g.printf("%s %s\n", f.name, f.typ)
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Parse%[1]s returns the arguments of sig, which must be the signal\n// %[2]s.\n", typeName, g.member(s.Name))
+	g.printf("func Parse%[1]s(sig *dbus.Signal) (*%[1]s, error) {\n", typeName)
+	g.printf("if sig.Name != %sInterface+%q {\n", name, "."+s.Name)
+	g.printf("return nil, fmt.Errorf(\"unexpected signal %%s\", sig.Name)\n}\n")
+	g.printf("s := &%s{Sender: sig.Sender, Path: sig.Path}\n", typeName)
+	if len(fields) > 0 {
+		ptrs := make([]string, 0, len(fields))
+		for _, f := range fields {
+			ptrs = append(ptrs, "&s."+f.name)
+		}
+		g.printf("if err := dbus.Store(sig.Body, %s); err != nil {\nreturn nil, err\n}\n", strings.Join(ptrs, ", "))
+	}
+	g.printf("return s, nil\n}\n\n")
+
+	g.printf("// %s subscribes ch to the signal %s of\n", subscribe, g.member(s.Name))
+	g.printf("// the object. conn must be the connection of the object; the signals can\n")
+	g.printf("// be decoded with Parse%s.\n", typeName)
+	g.printf("func (o *%s) %s(conn *dbus.Conn, ch chan<- *dbus.Signal) (*dbus.Subscription, error) {\n",
+		name, subscribe)
+	g.printf("return conn.Subscribe(ch,\n")
+	g.printf("dbus.WithMatchSender(o.obj.Destination()),\n")
+	g.printf("dbus.WithMatchObjectPath(o.obj.Path()),\n")
+	g.printf("dbus.WithMatchInterface(%sInterface),\n", name)
+	g.printf("dbus.WithMatchMember(%q))\n}\n", s.Name)
+	return nil
+}
+
+func (g *generator) writeServer(iface introspect.Interface, name string) error {
+	if err := g.declare(name+"Server", "Export"+name); err != nil {
+		return err
+	}
+	g.printf("\n// %sServer is implemented by the values that are exported as\n", name)
+	g.printf("// %s with Export%s. Properties and signals are not part of\n", iface.Name, name)
+	g.printf("// it; they can be provided with the prop package and the Emit functions.\n")
+	g.printf("type %sServer interface {\n", name)
+	mapping := make(map[string]string)
+	goNames := methodNames(iface)
+	for i, m := range iface.Methods {
+		used := make(map[string]bool)
+		in, err := params(methodArgs(m, "in"), "arg", localName, used)
+		if err != nil {
+			return fmt.Errorf("method %s: %v", m.Name, err)
+		}
+		out, err := params(methodArgs(m, "out"), "out", localName, used)
+		if err != nil {
+			return fmt.Errorf("method %s: %v", m.Name, err)
+		}
+		goName := goNames[i]
+		if goName != m.Name {
+			mapping[goName] = m.Name
+		}
+		g.printf("%s(%s) (%serr *dbus.Error)\n", goName, joinParams(in, false, false), joinParams(out, false, true))
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Export%[1]s exports s as %[2]s on path.\n", name, iface.Name)
+	g.printf("func Export%[1]s(conn *dbus.Conn, s %[1]sServer, path dbus.ObjectPath) error {\n", name)
+	if len(mapping) == 0 {
+		g.printf("return conn.Export(s, path, %sInterface)\n}\n", name)
+	} else {
+		keys := make([]string, 0, len(mapping))
+		for k := range mapping {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		g.printf("return conn.ExportWithMap(s, map[string]string{\n")
+		for _, k := range keys {
+			g.printf("%q: %q,\n", k, mapping[k])
+		}
+		g.printf("}, path, %sInterface)\n}\n", name)
+	}
+
+	signals := signalNames(iface)
+	for i, s := range iface.Signals {
+		args, err := params(s.Args, "arg", localName, make(map[string]bool))
+		if err != nil {
+			return fmt.Errorf("signal %s: %v", s.Name, err)
+		}
+		if err := g.declare("Emit" + name + signals[i]); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(args))
+		for _, a := range args {
+			names = append(names, ", "+a.name)
+		}
+		g.printf("\n// Emit%[1]s%[2]s emits the signal %[3]s from path.\n", name, signals[i], g.member(s.Name))
+		g.printf("func Emit%s%s(conn *dbus.Conn, path dbus.ObjectPath%s) error {\n",
+			name, signals[i], joinParams(args, true, false))
+		g.printf("return conn.Emit(path, %sInterface+%q%s)\n}\n", name, "."+s.Name, strings.Join(names, ""))
+	}
+	return nil
+}
+
+// member returns the full name of a member of the current interface.
+func (g *generator) member(name string) string {
+	return g.iface + "." + name
+}
+
+// methodArgs returns the arguments of m with the given direction. Arguments
+// of methods are input arguments if they have no direction.
+func methodArgs(m introspect.Method, direction string) []introspect.Arg {
+	var args []introspect.Arg
+	for _, a := range m.Args {
+		dir := a.Direction
+		if dir == "" {
+			dir = "in"
+		}
+		if dir == direction {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// params converts args to Go parameters. Unnamed arguments are named after
+// prefix and their position; names that are already in used get a suffix.
+func params(args []introspect.Arg, prefix string, ident func(string) string, used map[string]bool) ([]param, error) {
+	ps := make([]param, 0, len(args))
+	for i, a := range args {
+		typ, err := goType(a.Type)
+		if err != nil {
+			return nil, err
+		}
+		name := prefix + strconv.Itoa(i)
+		if a.Name != "" {
+			name = ident(a.Name)
+		}
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		ps = append(ps, param{name, typ})
+	}
+	return ps, nil
+}
+
+// joinParams returns the parameter list for ps. If leading is set, it starts
+// with a comma; if trailing is set, it ends with one.
+func joinParams(ps []param, leading, trailing bool) string {
+	var s []string
+	for _, p := range ps {
+		s = append(s, p.name+" "+p.typ)
+	}
+	list := strings.Join(s, ", ")
+	if list == "" {
+		return ""
+	}
+	if leading {
+		list = ", " + list
+	}
+	if trailing {
+		list += ", "
+	}
+	return list
+}
+
+func hasAnnotation(annotations []introspect.Annotation, name string) bool {
+	for _, a := range annotations {
+		if a.Name == name && a.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
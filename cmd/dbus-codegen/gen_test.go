@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/xml"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/introspect"
+)
+
+const testXML = `
+<node>
+	<interface name="org.example.Battery">
+		<method name="Charge">
+			<arg name="level" type="y" direction="in"/>
+			<arg name="type" type="s"/>
+			<arg name="ok" type="b" direction="out"/>
+			<arg type="a{sv}" direction="out"/>
+		</method>
+		<method name="reset">
+			<annotation name="org.freedesktop.DBus.Method.NoReply" value="true"/>
+		</method>
+		<method name="Object">
+			<arg name="fd" type="h"/>
+		</method>
+		<method name="GetName"/>
+		<method name="SubscribeChanged"/>
+		<property name="Level" type="y" access="read"/>
+		<property name="Name" type="s" access="readwrite"/>
+		<signal name="Changed">
+			<arg name="level" type="y"/>
+			<arg name="path" type="o"/>
+		</signal>
+	</interface>
+	<interface name="org.freedesktop.DBus.Properties"/>
+</node>`
+
+func TestGoType(t *testing.T) {
+	tests := []struct {
+		sig, typ string
+	}{
+		{"y", "byte"},
+		{"o", "dbus.ObjectPath"},
+		{"h", "dbus.UnixFD"},
+		{"as", "[]string"},
+		{"a{sv}", "map[string]dbus.Variant"},
+		{"a{oa{sa{sv}}}", "map[dbus.ObjectPath]map[string]map[string]dbus.Variant"},
+		{"(su)", "struct {\nV0 string\nV1 uint32\n}"},
+	}
+	for _, test := range tests {
+		typ, err := goType(test.sig)
+		if err != nil || typ != test.typ {
+			t.Errorf("goType(%q) = %q, %v; want %q", test.sig, typ, err, test.typ)
+		}
+	}
+	for _, sig := range []string{"", "a", "a{s}", "()", "(s", "ss", "z"} {
+		if _, err := goType(sig); err == nil {
+			t.Errorf("goType(%q) succeeded", sig)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var node introspect.Node
+	if err := xml.Unmarshal([]byte(testXML), &node); err != nil {
+		t.Fatal(err)
+	}
+	interfaces := selectInterfaces([]*introspect.Node{&node}, nil)
+	if len(interfaces) != 1 {
+		t.Fatalf("standard interfaces not skipped: %v", interfaces)
+	}
+	src, err := generate(interfaces, options{Package: "battery", Client: true, Server: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeCheck(t, src)
+	expected := []string{
+		`const BatteryInterface = "org.example.Battery"`,
+		"func (o *Battery) Charge(ctx context.Context, level byte, type_ string) (ok bool, out1 map[string]dbus.Variant, err error)",
+		".Store(&ok, &out1)",
+		`o.obj.CallWithContext(ctx, BatteryInterface+".reset", dbus.FlagNoReplyExpected).Err`,
+		"func (o *Battery) GetLevel(ctx context.Context) (v byte, err error)",
+		"func (o *Battery) ObjectMethod(ctx context.Context, fd dbus.UnixFD) (err error)",
+		"func (o *Battery) GetNameProperty(ctx context.Context) (v string, err error)",
+		"func (o *Battery) SetNameProperty(ctx context.Context, v string) error",
+		"func (o *Battery) SubscribeChangedSignal(conn *dbus.Conn, ch chan<- *dbus.Signal) (*dbus.Subscription, error)",
+		"Object(fd dbus.UnixFD) (err *dbus.Error)",
+		"Path_  dbus.ObjectPath",
+		"func ParseBatteryChangedSignal(sig *dbus.Signal) (*BatteryChangedSignal, error)",
+		"Reset() (err *dbus.Error)",
+		`"Reset": "reset",`,
+		"func EmitBatteryChanged(conn *dbus.Conn, path dbus.ObjectPath, level byte, path_ dbus.ObjectPath) error",
+	}
+	for _, s := range expected {
+		if !strings.Contains(string(src), s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, src)
+		}
+	}
+	if strings.Contains(string(src), "SetLevel") {
+		t.Error("setter generated for read-only property")
+	}
+}
+
+func TestGenerateCollision(t *testing.T) {
+	// the Go names of both interfaces are Battery
+	interfaces := []introspect.Interface{{Name: "org.example.Battery"}, {Name: "org.example.battery"}}
+	if _, err := generate(interfaces, options{Package: "battery", Client: true}); err == nil {
+		t.Error("colliding interface names not detected")
+	}
+}
+
+// typeCheck fails t if src doesn't compile.
+func typeCheck(t *testing.T, src []byte) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "battery.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("battery", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("generated code doesn't compile: %v\n%s", err, src)
+	}
+}
+
+func TestGoNames(t *testing.T) {
+	names := goNames([]introspect.Interface{
+		{Name: "org.example.One.Device"},
+		{Name: "org.example.Two.Device"},
+		{Name: "org.example.Manager"},
+	})
+	if names["org.example.One.Device"] != "OrgExampleOneDevice" || names["org.example.Manager"] != "Manager" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
@@ -0,0 +1,164 @@
+// Command dbus-codegen generates Go bindings for D-Bus interfaces from
+// introspection data.
+//
+// The introspection data is read from the XML files given as arguments or,
+// if -dest is set, from a live object on the session or system bus. For every
+// interface, dbus-codegen emits a client type with a method per D-Bus method,
+// accessors for its properties and helpers to subscribe to and parse its
+// signals, as well as a server interface, a function to export values that
+// implement it and functions to emit its signals. Methods of the client whose
+// names would collide get a suffix, e.g. ObjectMethod for a D-Bus method named
+// Object or GetFooProperty for the property Foo if there is a method GetFoo.
+//
+// It is meant to be used with go generate:
+//
+//	//go:generate dbus-codegen -o battery.go battery.xml
+//
+// Usage:
+//
+//	dbus-codegen [flags] [file.xml ...]
+//
+// The flags are:
+//
+//	-package name
+//		package of the generated file (default $GOPACKAGE or main)
+//	-o file
+//		write the output to file instead of stdout
+//	-interface names
+//		comma-separated list of the interfaces to generate; the standard
+//		org.freedesktop.DBus interfaces are skipped if it isn't given
+//	-dest name, -path path
+//		introspect the object path of the bus name dest
+//	-system
+//		use the system bus instead of the session bus for -dest
+//	-client, -server
+//		generate the client or server code (both are enabled by default)
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+)
+
+func main() {
+	opts := options{Package: os.Getenv("GOPACKAGE")}
+	if opts.Package == "" {
+		opts.Package = "main"
+	}
+	flag.StringVar(&opts.Package, "package", opts.Package, "package of the generated file")
+	flag.BoolVar(&opts.Client, "client", true, "generate client code")
+	flag.BoolVar(&opts.Server, "server", true, "generate server code")
+	output := flag.String("o", "", "output file (default stdout)")
+	ifaceList := flag.String("interface", "", "comma-separated list of the interfaces to generate")
+	dest := flag.String("dest", "", "bus name of the object to introspect")
+	path := flag.String("path", "/", "path of the object to introspect")
+	system := flag.Bool("system", false, "use the system bus for -dest")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file.xml ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var nodes []*introspect.Node
+	if *dest != "" {
+		node, err := introspectObject(*dest, dbus.ObjectPath(*path), *system)
+		if err != nil {
+			fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	for _, file := range flag.Args() {
+		node, err := readFile(file)
+		if err != nil {
+			fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var wanted map[string]bool
+	if *ifaceList != "" {
+		wanted = make(map[string]bool)
+		for _, name := range strings.Split(*ifaceList, ",") {
+			wanted[strings.TrimSpace(name)] = true
+		}
+	}
+	interfaces := selectInterfaces(nodes, wanted)
+	if len(interfaces) == 0 {
+		fatal(fmt.Errorf("no interfaces to generate"))
+	}
+
+	src, err := generate(interfaces, opts)
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "dbus-codegen:", err)
+	os.Exit(1)
+}
+
+func readFile(file string) (*introspect.Node, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var node introspect.Node
+	if err := xml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return &node, nil
+}
+
+func introspectObject(dest string, path dbus.ObjectPath, system bool) (*introspect.Node, error) {
+	var conn *dbus.Conn
+	var err error
+	if system {
+		conn, err = dbus.SystemBus()
+	} else {
+		conn, err = dbus.SessionBus()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return introspect.Call(conn.Object(dest, path))
+}
+
+// selectInterfaces returns the interfaces of nodes that are in wanted, or
+// that aren't standard interfaces if wanted is nil. Interfaces that appear
+// more than once are only returned once.
+func selectInterfaces(nodes []*introspect.Node, wanted map[string]bool) []introspect.Interface {
+	var interfaces []introspect.Interface
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		for _, iface := range node.Interfaces {
+			if seen[iface.Name] {
+				continue
+			}
+			if wanted != nil && !wanted[iface.Name] || wanted == nil && standardInterfaces[iface.Name] {
+				continue
+			}
+			seen[iface.Name] = true
+			interfaces = append(interfaces, iface)
+		}
+	}
+	return interfaces
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goType returns the Go type that is used for values of the D-Bus type sig.
+// Structs are represented by anonymous Go structs, so that they have the
+// right signature when they are sent.
+func goType(sig string) (string, error) {
+	typ, rest, err := parseType(sig)
+	if err != nil {
+		return "", err
+	}
+	if rest != "" {
+		return "", errors.New("signature " + sig + " contains more than one type")
+	}
+	return typ, nil
+}
+
+func parseType(sig string) (typ, rest string, err error) {
+	if sig == "" {
+		return "", "", errors.New("empty signature")
+	}
+	switch sig[0] {
+	case 'y':
+		return "byte", sig[1:], nil
+	case 'b':
+		return "bool", sig[1:], nil
+	case 'n':
+		return "int16", sig[1:], nil
+	case 'q':
+		return "uint16", sig[1:], nil
+	case 'i':
+		return "int32", sig[1:], nil
+	case 'u':
+		return "uint32", sig[1:], nil
+	case 'x':
+		return "int64", sig[1:], nil
+	case 't':
+		return "uint64", sig[1:], nil
+	case 'd':
+		return "float64", sig[1:], nil
+	case 's':
+		return "string", sig[1:], nil
+	case 'o':
+		return "dbus.ObjectPath", sig[1:], nil
+	case 'g':
+		return "dbus.Signature", sig[1:], nil
+	case 'h':
+		return "dbus.UnixFD", sig[1:], nil
+	case 'v':
+		return "dbus.Variant", sig[1:], nil
+	case 'a':
+		if len(sig) > 1 && sig[1] == '{' {
+			key, rest, err := parseType(sig[2:])
+			if err != nil {
+				return "", "", err
+			}
+			val, rest, err := parseType(rest)
+			if err != nil {
+				return "", "", err
+			}
+			if rest == "" || rest[0] != '}' {
+				return "", "", errors.New("unterminated dict entry in " + sig)
+			}
+			return "map[" + key + "]" + val, rest[1:], nil
+		}
+		elem, rest, err := parseType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "[]" + elem, rest, nil
+	case '(':
+		var fields []string
+		rest := sig[1:]
+		for rest != "" && rest[0] != ')' {
+			var field string
+			field, rest, err = parseType(rest)
+			if err != nil {
+				return "", "", err
+			}
+			fields = append(fields, "V"+strconv.Itoa(len(fields))+" "+field)
+		}
+		if rest == "" || len(fields) == 0 {
+			return "", "", errors.New("invalid struct in " + sig)
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}", rest[1:], nil
+	}
+	return "", "", errors.New("invalid type " + string(sig[0]) + " in signature")
+}
+
+// exportedName returns an exported Go identifier for the D-Bus name s.
+func exportedName(s string) string {
+	s = identifier(s)
+	if s[0] == '_' {
+		return "X" + s
+	}
+	return string(unicode.ToUpper(rune(s[0]))) + s[1:]
+}
+
+// localName returns a Go identifier for a parameter that isn't a keyword.
+func localName(s string) string {
+	s = identifier(s)
+	s = string(unicode.ToLower(rune(s[0]))) + s[1:]
+	if isReserved(s) {
+		return s + "_"
+	}
+	return s
+}
+
+// identifier replaces the characters of s that can't be used in a Go
+// identifier.
+func identifier(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+func isReserved(s string) bool {
+	switch s {
+	case "break", "case", "chan", "const", "continue", "default", "defer",
+		"else", "fallthrough", "for", "func", "go", "goto", "if", "import",
+		"interface", "map", "package", "range", "return", "select", "struct",
+		"switch", "type", "var",
+		// names used by the generated code
+		"ctx", "err", "o", "conn", "path", "dbus", "context", "fmt":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+)
+
+const propertiesIface = "org.freedesktop.DBus.Properties"
+
+func list(conn *dbus.Conn, args []string) error {
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return err
+	}
+	sort.Strings(names)
+	if *jsonOut {
+		return printJSON(names)
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func tree(conn *dbus.Conn, args []string) error {
+	root := dbus.ObjectPath("/")
+	if len(args) > 1 {
+		root = dbus.ObjectPath(args[1])
+	}
+	if !root.IsValid() {
+		return fmt.Errorf("invalid object path %q", root)
+	}
+	node, err := introspect.Call(conn.Object(args[0], root))
+	if err != nil {
+		return err
+	}
+	paths := []dbus.ObjectPath{root}
+	paths = walk(conn, args[0], root, node, paths)
+	if *jsonOut {
+		return printJSON(paths)
+	}
+	for _, path := range paths {
+		depth := 0
+		if path != root {
+			depth = strings.Count(strings.TrimPrefix(string(path), string(root)), "/")
+			if root == "/" {
+				depth++
+			}
+		}
+		fmt.Println(strings.Repeat("  ", depth) + string(path))
+	}
+	return nil
+}
+
+// walk appends the paths of the children of node (which is the node on path)
+// and their descendants to paths.
+func walk(conn *dbus.Conn, dest string, path dbus.ObjectPath, node *introspect.Node, paths []dbus.ObjectPath) []dbus.ObjectPath {
+	names := make([]string, 0, len(node.Children))
+	for _, child := range node.Children {
+		names = append(names, child.Name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := path + "/" + dbus.ObjectPath(name)
+		if path == "/" {
+			child = "/" + dbus.ObjectPath(name)
+		}
+		paths = append(paths, child)
+		// objects that can't be introspected are listed without children
+		if node, err := introspect.Call(conn.Object(dest, child)); err == nil {
+			paths = walk(conn, dest, child, node, paths)
+		}
+	}
+	return paths
+}
+
+// member is a line in the output of introspect.
+type member struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Signature string      `json:"signature,omitempty"`
+	Result    string      `json:"result,omitempty"`
+	Access    string      `json:"access,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+}
+
+func introspectObject(conn *dbus.Conn, args []string) error {
+	obj := conn.Object(args[0], dbus.ObjectPath(args[1]))
+	node, err := introspect.Call(obj)
+	if err != nil {
+		return err
+	}
+	var members []member
+	for _, iface := range node.Interfaces {
+		members = append(members, member{Name: iface.Name, Type: "interface"})
+		for _, m := range iface.Methods {
+			in, out := methodSignatures(m)
+			members = append(members, member{Name: "." + m.Name, Type: "method", Signature: in, Result: out})
+		}
+		var values map[string]dbus.Variant
+		if len(iface.Properties) > 0 {
+			obj.Call(propertiesIface+".GetAll", 0, iface.Name).Store(&values)
+		}
+		for _, p := range iface.Properties {
+			m := member{Name: "." + p.Name, Type: "property", Signature: p.Type, Access: p.Access}
+			if v, ok := values[p.Name]; ok {
+				m.Value = v
+			}
+			members = append(members, m)
+		}
+		for _, s := range iface.Signals {
+			var sig string
+			for _, arg := range s.Args {
+				sig += arg.Type
+			}
+			members = append(members, member{Name: "." + s.Name, Type: "signal", Signature: sig})
+		}
+	}
+
+	if *jsonOut {
+		for i := range members {
+			if v, ok := members[i].Value.(dbus.Variant); ok {
+				members[i].Value = jsonVariant(v)
+			}
+		}
+		return printJSON(members)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSIGNATURE\tRESULT/VALUE\tACCESS")
+	for _, m := range members {
+		result := m.Result
+		if v, ok := m.Value.(dbus.Variant); ok {
+			result = v.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.Type, dash(m.Signature), dash(result), dash(m.Access))
+	}
+	return w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// methodSignatures returns the signatures of the input and output arguments
+// of m.
+func methodSignatures(m introspect.Method) (in, out string) {
+	for _, arg := range m.Args {
+		if arg.Direction == "out" {
+			out += arg.Type
+		} else {
+			in += arg.Type
+		}
+	}
+	return
+}
+
+func call(conn *dbus.Conn, args []string) error {
+	obj := conn.Object(args[0], dbus.ObjectPath(args[1]))
+	iface, method, err := splitMember(args[2])
+	if err != nil {
+		return err
+	}
+	values, err := parseArgs(args[3:], func() (string, bool) {
+		node, err := introspect.Call(obj)
+		if err != nil {
+			return "", false
+		}
+		for _, i := range node.Interfaces {
+			for _, m := range i.Methods {
+				if i.Name == iface && m.Name == method {
+					in, _ := methodSignatures(m)
+					return in, true
+				}
+			}
+		}
+		return "", false
+	})
+	if err != nil {
+		return err
+	}
+	c := obj.Call(iface+"."+method, 0, values...)
+	if c.Err != nil {
+		return c.Err
+	}
+	if *jsonOut {
+		return printJSON(jsonBody(c.Body))
+	}
+	for _, v := range c.Body {
+		fmt.Println(dbus.MakeVariant(v).String())
+	}
+	return nil
+}
+
+func get(conn *dbus.Conn, args []string) error {
+	obj := conn.Object(args[0], dbus.ObjectPath(args[1]))
+	for _, name := range args[3:] {
+		var v dbus.Variant
+		if err := obj.Call(propertiesIface+".Get", 0, args[2], name).Store(&v); err != nil {
+			return err
+		}
+		if *jsonOut {
+			if err := printJSON(jsonVariant(v)); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Println(v.String())
+	}
+	return nil
+}
+
+func set(conn *dbus.Conn, args []string) error {
+	obj := conn.Object(args[0], dbus.ObjectPath(args[1]))
+	iface, name := args[2], args[3]
+	values, err := parseArgs(args[4:], func() (string, bool) {
+		node, err := introspect.Call(obj)
+		if err != nil {
+			return "", false
+		}
+		for _, i := range node.Interfaces {
+			for _, p := range i.Properties {
+				if i.Name == iface && p.Name == name {
+					return p.Type, true
+				}
+			}
+		}
+		return "", false
+	})
+	if err != nil {
+		return err
+	}
+	return obj.Call(propertiesIface+".Set", 0, iface, name, dbus.MakeVariant(values[0])).Err
+}
+
+func emit(conn *dbus.Conn, args []string) error {
+	if _, _, err := splitMember(args[1]); err != nil {
+		return err
+	}
+	values, err := parseArgs(args[2:], nil)
+	if err != nil {
+		return err
+	}
+	return conn.Emit(dbus.ObjectPath(args[0]), args[1], values...)
+}
+
+func monitor(conn *dbus.Conn, args []string) error {
+	ch := make(chan *dbus.Message, 64)
+	if err := conn.BecomeMonitor(ch, args...); err != nil {
+		return err
+	}
+	for msg := range ch {
+		if *jsonOut {
+			if err := printJSON(jsonMessage(msg)); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Println(msg)
+	}
+	return nil
+}
+
+// splitMember splits a name like org.example.Interface.Member.
+func splitMember(name string) (iface, member string, err error) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid member %q, expected INTERFACE.MEMBER", name)
+	}
+	return name[:i], name[i+1:], nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/godbus/dbus"
+)
+
+// parseArgs parses the arguments of call, set or emit. Their signature is
+// taken from -signature or, if it isn't set, from lookup, which may be nil.
+func parseArgs(args []string, lookup func() (string, bool)) ([]interface{}, error) {
+	sig, known := *signature, *signature != ""
+	if !known && lookup != nil {
+		sig, known = lookup()
+	}
+	return parseValues(args, sig, known)
+}
+
+// parseValues parses args with the signature sig. If known is false, the
+// types of the arguments are inferred.
+func parseValues(args []string, sig string, known bool) ([]interface{}, error) {
+	sigs := make([]dbus.Signature, len(args))
+	if known {
+		var err error
+		if sigs, err = splitSignature(sig); err != nil {
+			return nil, err
+		}
+		if len(sigs) != len(args) {
+			return nil, fmt.Errorf("signature %q expects %d arguments, got %d", sig, len(sigs), len(args))
+		}
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		v, err := parseValue(arg, sigs[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// parseValue parses s as a value of type sig. Strings, object paths and
+// signatures may be given without quotes.
+func parseValue(s string, sig dbus.Signature) (interface{}, error) {
+	v, err := dbus.ParseVariant(s, sig)
+	if err == nil {
+		return v.Value(), nil
+	}
+	switch sig {
+	case "s":
+		return s, nil
+	case "o":
+		if p := dbus.ObjectPath(s); p.IsValid() {
+			return p, nil
+		}
+	case "g":
+		if parsed, err := dbus.ParseSignature(dbus.Signature(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid argument %q: %v", s, err)
+}
+
+// splitSignature splits sig into single complete types.
+func splitSignature(sig string) ([]dbus.Signature, error) {
+	if _, err := dbus.ParseSignature(dbus.Signature(sig)); err != nil {
+		return nil, err
+	}
+	var sigs []dbus.Signature
+	for sig != "" {
+		n := singleLength(sig)
+		sigs = append(sigs, dbus.Signature(sig[:n]))
+		sig = sig[n:]
+	}
+	return sigs, nil
+}
+
+// singleLength returns the length of the first complete type in the valid
+// signature sig.
+func singleLength(sig string) int {
+	i := 0
+	for sig[i] == 'a' {
+		i++
+	}
+	if sig[i] != '(' && sig[i] != '{' {
+		return i + 1
+	}
+	depth := 0
+	for ; i < len(sig); i++ {
+		switch sig[i] {
+		case '(', '{':
+			depth++
+		case ')', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sig)
+}
+
+func printJSON(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// jsonVariant returns the JSON representation of a variant, which contains
+// its signature and its value.
+func jsonVariant(v dbus.Variant) interface{} {
+	return map[string]interface{}{
+		"type": v.Signature().String(),
+		"data": jsonValue(v.Value()),
+	}
+}
+
+// jsonBody returns the JSON representation of the body of a message.
+func jsonBody(body []interface{}) interface{} {
+	return map[string]interface{}{
+		"type": dbus.SignatureOf(body...).String(),
+		"data": jsonValue(body),
+	}
+}
+
+// jsonValue converts v to a value that encoding/json represents correctly.
+// Variants are converted by jsonVariant, byte slices are encoded as arrays
+// instead of base64 and all map keys are converted to strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case dbus.Variant:
+		return jsonVariant(v)
+	case dbus.ObjectPath:
+		return string(v)
+	case dbus.Signature:
+		return v.String()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = jsonValue(rv.Index(i).Interface())
+		}
+		return s
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = jsonValue(rv.MapIndex(k).Interface())
+		}
+		return m
+	}
+	return v
+}
+
+var headerNames = map[dbus.HeaderField]string{
+	dbus.FieldPath:        "path",
+	dbus.FieldInterface:   "interface",
+	dbus.FieldMember:      "member",
+	dbus.FieldErrorName:   "error_name",
+	dbus.FieldReplySerial: "reply_serial",
+	dbus.FieldDestination: "destination",
+	dbus.FieldSender:      "sender",
+	dbus.FieldSignature:   "signature",
+	dbus.FieldUnixFDs:     "unix_fds",
+}
+
+// jsonMessage returns the JSON representation of msg.
+func jsonMessage(msg *dbus.Message) interface{} {
+	m := map[string]interface{}{
+		"type":   msg.Type.String(),
+		"serial": msg.Serial(),
+		"flags":  msg.Flags,
+	}
+	for field, v := range msg.Headers {
+		if name, ok := headerNames[field]; ok {
+			m[name] = jsonValue(v.Value())
+		}
+	}
+	if len(msg.Body) > 0 {
+		m["body"] = jsonValue(msg.Body)
+	}
+	return m
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestSplitSignature(t *testing.T) {
+	sigs, err := splitSignature("sa{sv}a(ii)aayv(s(u))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []dbus.Signature{"s", "a{sv}", "a(ii)", "aay", "v", "(s(u))"}
+	if !reflect.DeepEqual(sigs, expected) {
+		t.Errorf("got %v, expected %v", sigs, expected)
+	}
+	if _, err := splitSignature("a{"); err == nil {
+		t.Error("invalid signature accepted")
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	values, err := parseValues([]string{"5", "hello", "/a/b", "['x', 'y']", "<true>"}, "usoasv", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{uint32(5), "hello", dbus.ObjectPath("/a/b"), []string{"x", "y"}, dbus.MakeVariant(true)}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("got %#v, expected %#v", values, expected)
+	}
+
+	values, err = parseValues([]string{"5", "'text'"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{int32(5), "text"}) {
+		t.Errorf("unexpected inferred values %#v", values)
+	}
+
+	if _, err := parseValues([]string{"5"}, "uu", true); err == nil {
+		t.Error("wrong number of arguments accepted")
+	}
+	if _, err := parseValues([]string{"text"}, "u", true); err == nil {
+		t.Error("invalid argument accepted")
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	v := map[string]dbus.Variant{
+		"bytes": dbus.MakeVariant([]byte{1, 2}),
+		"ids":   dbus.MakeVariant(map[uint32]dbus.ObjectPath{1: "/a"}),
+	}
+	b, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"bytes":{"data":[1,2],"type":"ay"},"ids":{"data":{"1":"/a"},"type":"a{uo}"}}`
+	if string(b) != expected {
+		t.Errorf("got %s, expected %s", b, expected)
+	}
+}
@@ -0,0 +1,140 @@
+// Command dbusctl inspects and talks to D-Bus message buses.
+//
+// Usage:
+//
+//	dbusctl [flags] command [arguments]
+//
+// The commands are:
+//
+//	list
+//		list the names on the bus
+//	tree DEST [PATH]
+//		show the object tree of DEST below PATH (default /)
+//	introspect DEST PATH
+//		show the interfaces, methods, properties and signals of an object
+//	call DEST PATH INTERFACE.METHOD [ARG ...]
+//		call a method and print its reply
+//	get DEST PATH INTERFACE PROPERTY ...
+//		print the values of properties
+//	set DEST PATH INTERFACE PROPERTY VALUE
+//		set the value of a property
+//	emit PATH INTERFACE.SIGNAL [ARG ...]
+//		emit a signal
+//	monitor [MATCH ...]
+//		print the messages on the bus that match the given match rules
+//		(or all messages); this requires a bus that supports
+//		org.freedesktop.DBus.Monitoring
+//
+// Arguments and values use the GVariant text format that is parsed by
+// dbus.ParseVariant, e.g. 42, 'text', [1, 2] or {'key': <true>}. Their types
+// are taken from -signature if it is set, or else from the introspection
+// data of the object if it is available; otherwise they are inferred from
+// the text. Arguments of type s, o and g may be given without quotes.
+//
+// Values are printed in the same format, or as JSON with -json.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus"
+)
+
+var (
+	system    = flag.Bool("system", false, "connect to the system bus")
+	address   = flag.String("address", "", "connect to the bus at this address")
+	jsonOut   = flag.Bool("json", false, "print the output as JSON")
+	signature = flag.String("signature", "", "signature of the arguments of call, emit and set")
+)
+
+type command struct {
+	usage string
+	min   int // minimal number of arguments
+	max   int // maximal number of arguments, or -1
+	run   func(conn *dbus.Conn, args []string) error
+}
+
+var commands = map[string]command{
+	"list":       {"list", 0, 0, list},
+	"tree":       {"tree DEST [PATH]", 1, 2, tree},
+	"introspect": {"introspect DEST PATH", 2, 2, introspectObject},
+	"call":       {"call DEST PATH INTERFACE.METHOD [ARG ...]", 3, -1, call},
+	"get":        {"get DEST PATH INTERFACE PROPERTY ...", 4, -1, get},
+	"set":        {"set DEST PATH INTERFACE PROPERTY VALUE", 5, 5, set},
+	"emit":       {"emit PATH INTERFACE.SIGNAL [ARG ...]", 2, -1, emit},
+	"monitor":    {"monitor [MATCH ...]", 0, -1, monitor},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] command [arguments]\n\ncommands:\n", os.Args[0])
+	for _, name := range []string{"list", "tree", "introspect", "call", "get", "set", "emit", "monitor"} {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	args = args[1:]
+	if !ok || len(args) < cmd.min || cmd.max >= 0 && len(args) > cmd.max {
+		if ok {
+			fmt.Fprintln(os.Stderr, "usage: dbusctl [flags] "+cmd.usage)
+		} else {
+			usage()
+		}
+		os.Exit(2)
+	}
+
+	conn, err := connect()
+	if err != nil {
+		fatal(err)
+	}
+	if err := cmd.run(conn, args); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "dbusctl:", err)
+	os.Exit(1)
+}
+
+// connect returns a private connection, as monitor changes the state of the
+// connection.
+func connect() (*dbus.Conn, error) {
+	var conn *dbus.Conn
+	var err error
+	switch {
+	case *address != "" && *system:
+		return nil, errors.New("-address and -system can't be used together")
+	case *address != "":
+		conn, err = dbus.Dial(*address)
+	case *system:
+		conn, err = dbus.SystemBusPrivate()
+	default:
+		conn, err = dbus.SessionBusPrivate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
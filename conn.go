@@ -35,6 +35,16 @@ type Conn struct {
 	busObj BusObject
 	unixFD bool
 	uuid   string
+	peer   *PeerCredentials
+
+	// address and authMethods are used to re-establish the connection.
+	address     string
+	authMethods []Auth
+	reconnect   *reconnector
+	busState    *busState
+
+	// trLck protects transport and unixFD while they are replaced.
+	trLck sync.RWMutex
 
 	names *nameTracker
 
@@ -42,7 +52,8 @@ type Conn struct {
 
 	calls *callTracker
 
-	handler Handler
+	handler    Handler
+	dispatcher *callDispatcher
 
 	outHandler *outputHandler
 
@@ -50,6 +61,35 @@ type Conn struct {
 
 	eavesdropped    chan<- *Message
 	eavesdroppedLck sync.Mutex
+
+	capture    func(msg *Message, sent bool)
+	captureLck sync.RWMutex
+
+	monitor    chan<- *Message
+	monitorLck sync.Mutex
+	// pendingMonitor is the channel passed to BecomeMonitor while the call
+	// with the serial monitorSerial is pending.
+	pendingMonitor chan<- *Message
+	monitorSerial  uint32
+
+	clientInterceptors []Interceptor
+	serverInterceptors []Interceptor
+	interceptorLck     sync.RWMutex
+
+	metrics    Metrics
+	metricsLck sync.RWMutex
+
+	matchRules map[string]int
+	matchLck   sync.Mutex
+
+	objectManagers    map[ObjectPath]*ObjectManager
+	objectManagersLck sync.Mutex
+
+	// ctx is the parent of the contexts passed to exported methods; it is
+	// cancelled when the connection is closed.
+	ctx            context.Context
+	cancelCtx      context.CancelFunc
+	handlerTimeout int64
 }
 
 // SessionBus returns a shared connection to the session bus, connecting to it
@@ -155,7 +195,12 @@ func Dial(address string) (*Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return newConn(tr, NewDefaultHandler(), NewDefaultSignalHandler())
+	conn, err := newConn(tr, NewDefaultHandler(), NewDefaultSignalHandler())
+	if err != nil {
+		return nil, err
+	}
+	conn.address = address
+	return conn, nil
 }
 
 // DialHandler establishes a new private connection to the message bus specified by address, using the supplied handlers.
@@ -164,7 +209,12 @@ func DialHandler(address string, handler Handler, signalHandler SignalHandler) (
 	if err != nil {
 		return nil, err
 	}
-	return newConn(tr, handler, signalHandler)
+	conn, err := newConn(tr, handler, signalHandler)
+	if err != nil {
+		return nil, err
+	}
+	conn.address = address
+	return conn, nil
 }
 
 // NewConn creates a new private *Conn from an already established connection.
@@ -182,11 +232,21 @@ func newConn(tr transport, handler Handler, signalHandler SignalHandler) (*Conn,
 	conn := new(Conn)
 	conn.transport = tr
 	conn.calls = newCallTracker()
+	conn.calls.pending = conn.pendingCalls
 	conn.handler = handler
 	conn.signalHandler = signalHandler
+	if sh, ok := signalHandler.(*defaultSignalHandler); ok {
+		sh.dropped = conn.signalDropped
+	}
 	conn.outHandler = &outputHandler{conn: conn}
 	conn.serialGen = newSerialGenerator()
 	conn.names = newNameTracker()
+	conn.reconnect = newReconnector()
+	conn.busState = newBusState()
+	conn.matchRules = make(map[string]int)
+	conn.objectManagers = make(map[ObjectPath]*ObjectManager)
+	conn.dispatcher = newCallDispatcher(conn.handleCall)
+	conn.ctx, conn.cancelCtx = context.WithCancel(context.Background())
 	conn.busObj = conn.Object("org.freedesktop.DBus", "/org/freedesktop/DBus")
 	return conn, nil
 }
@@ -202,6 +262,9 @@ func (conn *Conn) BusObject() BusObject {
 // not be called on shared connections.
 func (conn *Conn) Close() error {
 	conn.outHandler.close()
+	conn.reconnect.stop()
+	conn.dispatcher.close()
+	conn.cancelCtx()
 	if term, ok := conn.signalHandler.(Terminator); ok {
 		term.Terminate()
 	}
@@ -216,6 +279,8 @@ func (conn *Conn) Close() error {
 	}
 	conn.eavesdroppedLck.Unlock()
 
+	conn.trLck.RLock()
+	defer conn.trLck.RUnlock()
 	return conn.transport.Close()
 }
 
@@ -233,6 +298,26 @@ func (conn *Conn) Eavesdrop(ch chan<- *Message) {
 	conn.eavesdroppedLck.Unlock()
 }
 
+// SetCapture sets a function that is called with every message that conn
+// sends or receives, in the order in which they are sent or received. sent is
+// true for outgoing messages. f is called synchronously, so it should return
+// quickly, and it must not modify msg. If nil is passed, messages are no
+// longer captured.
+func (conn *Conn) SetCapture(f func(msg *Message, sent bool)) {
+	conn.captureLck.Lock()
+	conn.capture = f
+	conn.captureLck.Unlock()
+}
+
+// captured passes msg to the capture function, if there is one.
+func (conn *Conn) captured(msg *Message, sent bool) {
+	conn.captureLck.RLock()
+	if conn.capture != nil {
+		conn.capture(msg, sent)
+	}
+	conn.captureLck.RUnlock()
+}
+
 // getSerial returns an unused serial.
 func (conn *Conn) getSerial() uint32 {
 	return conn.serialGen.getSerial()
@@ -258,21 +343,37 @@ func (conn *Conn) inWorker() {
 		msg, err := conn.ReadMessage()
 		if err != nil {
 			if _, ok := err.(InvalidMessageError); !ok {
+				if conn.reconnecting() {
+					// the reply to pending calls was lost with the old
+					// connection.
+					conn.calls.finalizeAllWithError(err)
+					conn.busState.forgetAll()
+					conn.closeMonitor()
+					conn.redial()
+					return
+				}
 				// Some read error occured (usually EOF); we can't really do
 				// anything but to shut down all stuff and returns errors to all
 				// pending replies.
 				conn.Close()
 				conn.calls.finalizeAllWithError(err)
+				conn.closeMonitor()
 				return
 			}
 			// invalid messages are ignored
 			continue
 		}
+		conn.captured(msg, false)
+		conn.messageReceived(msg)
+		if conn.monitored(msg) {
+			continue
+		}
 		conn.eavesdroppedLck.Lock()
 		if conn.eavesdropped != nil {
 			select {
 			case conn.eavesdropped <- msg:
 			default:
+				conn.eavesdropDropped()
 			}
 			conn.eavesdroppedLck.Unlock()
 			continue
@@ -289,13 +390,18 @@ func (conn *Conn) inWorker() {
 		}
 		switch msg.Type {
 		case TypeError:
+			conn.busState.handleReply(msg)
 			conn.serialGen.retireSerial(conn.calls.handleDBusError(msg))
 		case TypeMethodReply:
+			conn.busState.handleReply(msg)
 			conn.serialGen.retireSerial(conn.calls.handleReply(msg))
 		case TypeSignal:
 			conn.handleSignal(msg)
 		case TypeMethodCall:
-			go conn.handleCall(msg)
+			if !conn.dispatcher.dispatch(msg) && msg.Flags&FlagNoReplyExpected == 0 {
+				sender, _ := msg.Headers[FieldSender].value.(string)
+				conn.sendError(errMsgLimitsExceeded, sender, msg.serial)
+			}
 		}
 
 	}
@@ -316,6 +422,7 @@ func (conn *Conn) handleSignal(msg *Message) {
 				panic("Unable to read the lost name")
 			}
 			conn.names.loseName(name)
+			conn.busState.nameLost(name)
 		} else if member == "NameAcquired" {
 			// If we acquired the name on the bus, add it to our
 			// tracking list.
@@ -350,13 +457,20 @@ func (conn *Conn) Object(dest string, path ObjectPath) BusObject {
 // outWorker runs in an own goroutine, encoding and sending messages that are
 // sent to conn.out.
 func (conn *Conn) sendMessage(msg *Message) {
-	conn.sendMessageAndIfClosed(msg, func() {})
+	conn.sendMessageAndIfClosed(msg, func(error) {})
 }
 
-func (conn *Conn) sendMessageAndIfClosed(msg *Message, ifClosed func()) {
-	err := conn.outHandler.sendAndIfClosed(msg, ifClosed)
+// sendMessageAndIfClosed sends msg. If conn is closed or in monitor mode, msg
+// is not sent and ifClosed is called with ErrClosed or ErrMonitor instead.
+func (conn *Conn) sendMessageAndIfClosed(msg *Message, ifClosed func(err error)) {
+	conn.busState.track(msg)
+	err := conn.outHandler.sendAndIfClosed(msg, func(err error) {
+		conn.busState.forget(msg.serial)
+		ifClosed(err)
+	})
 	conn.calls.handleSendError(msg, err)
 	if err != nil {
+		conn.busState.forget(msg.serial)
 		conn.serialGen.retireSerial(msg.serial)
 	} else if msg.Type != TypeMethodCall {
 		conn.serialGen.retireSerial(msg.serial)
@@ -383,9 +497,21 @@ func (conn *Conn) send(ctx context.Context, msg *Message, ch chan *Call) *Call {
 		panic("nil context")
 	}
 
+	if msg.Type == TypeMethodCall {
+		if interceptors := conn.getClientInterceptors(); interceptors != nil {
+			return conn.interceptCall(ctx, msg, ch, interceptors)
+		}
+	}
+
+	msg.serial = conn.getSerial()
+	return conn.sendWithSerial(ctx, msg, ch)
+}
+
+// sendWithSerial is like send, but msg already has a serial and isn't passed
+// through the client interceptors.
+func (conn *Conn) sendWithSerial(ctx context.Context, msg *Message, ch chan *Call) *Call {
 	var call *Call
 	ctx, canceler := context.WithCancel(ctx)
-	msg.serial = conn.getSerial()
 	if msg.Type == TypeMethodCall && msg.Flags&FlagNoReplyExpected == 0 {
 		if ch == nil {
 			ch = make(chan *Call, 5)
@@ -402,20 +528,21 @@ func (conn *Conn) send(ctx context.Context, msg *Message, ch chan *Call) *Call {
 		call.Done = ch
 		call.ctx = ctx
 		call.ctxCanceler = canceler
+		conn.observeCall(call, msg)
 		conn.calls.track(msg.serial, call)
 		go func() {
 			<-ctx.Done()
 			conn.calls.handleSendError(msg, ctx.Err())
 		}()
-		conn.sendMessageAndIfClosed(msg, func() {
-			conn.calls.handleSendError(msg, ErrClosed)
+		conn.sendMessageAndIfClosed(msg, func(err error) {
+			conn.calls.handleSendError(msg, err)
 			canceler()
 		})
 	} else {
 		canceler()
 		call = &Call{Err: nil}
-		conn.sendMessageAndIfClosed(msg, func() {
-			call = &Call{Err: ErrClosed}
+		conn.sendMessageAndIfClosed(msg, func(err error) {
+			call = &Call{Err: err}
 		})
 	}
 	return call
@@ -479,8 +606,12 @@ func (conn *Conn) defaultSignalAction(fn func(h *defaultSignalHandler, ch chan<-
 }
 
 // Signal registers the given channel to be passed all received signal messages.
-// The caller has to make sure that ch is sufficiently buffered; if a message
-// arrives when a write to c is not possible, it is discarded.
+// Signals are queued for each channel and sent to it in the order in which
+// they were received. No signal is discarded: if the queue is full, the
+// connection stops processing incoming messages until ch is read from. In
+// particular, a method call made while the queue is full doesn't return until
+// ch is drained. Use SetSignalQueue to change the size of the queue or to
+// discard signals instead.
 //
 // Multiple of these channels can be registered at the same time.
 //
@@ -501,9 +632,22 @@ func (conn *Conn) RemoveSignal(ch chan<- *Signal) {
 // descriptors will return an error and emitted signals containing them will
 // not be sent.
 func (conn *Conn) SupportsUnixFDs() bool {
+	conn.trLck.RLock()
+	defer conn.trLck.RUnlock()
 	return conn.unixFD
 }
 
+// PeerCredentials returns the credentials of the process at the other end of
+// the connection, or nil if they are unknown. They are only available for
+// connections returned by (*Server).Accept on transports that support it.
+func (conn *Conn) PeerCredentials() *PeerCredentials {
+	if conn.peer == nil {
+		return nil
+	}
+	creds := *conn.peer
+	return &creds
+}
+
 // Error represents a D-Bus message of type Error.
 type Error struct {
 	Name string
@@ -608,20 +752,31 @@ type outputHandler struct {
 	sendLck sync.Mutex
 	closed  struct {
 		isClosed bool
-		lck      sync.RWMutex
+		// connections in monitor mode must not send messages
+		isMonitor bool
+		lck       sync.RWMutex
 	}
 }
 
-func (h *outputHandler) sendAndIfClosed(msg *Message, ifClosed func()) error {
+func (h *outputHandler) sendAndIfClosed(msg *Message, ifClosed func(err error)) error {
 	h.closed.lck.RLock()
 	defer h.closed.lck.RUnlock()
 	if h.closed.isClosed {
-		ifClosed()
+		ifClosed(ErrClosed)
+		return nil
+	}
+	if h.closed.isMonitor {
+		ifClosed(ErrMonitor)
 		return nil
 	}
 	h.sendLck.Lock()
 	defer h.sendLck.Unlock()
-	return h.conn.SendMessage(msg)
+	if err := h.conn.SendMessage(msg); err != nil {
+		return err
+	}
+	h.conn.captured(msg, true)
+	h.conn.messageSent(msg)
+	return nil
 }
 
 func (h *outputHandler) close() {
@@ -630,6 +785,12 @@ func (h *outputHandler) close() {
 	h.closed.isClosed = true
 }
 
+func (h *outputHandler) setMonitor() {
+	h.closed.lck.Lock()
+	defer h.closed.lck.Unlock()
+	h.closed.isMonitor = true
+}
+
 type serialGenerator struct {
 	lck        sync.Mutex
 	nextSerial uint32
@@ -686,6 +847,13 @@ func (tracker *nameTracker) loseName(name string) {
 	delete(tracker.names, name)
 }
 
+func (tracker *nameTracker) reset() {
+	tracker.lck.Lock()
+	defer tracker.lck.Unlock()
+	tracker.unique = ""
+	tracker.names = map[string]struct{}{}
+}
+
 func (tracker *nameTracker) uniqueNameIsKnown() bool {
 	tracker.lck.RLock()
 	defer tracker.lck.RUnlock()
@@ -711,6 +879,9 @@ func (tracker *nameTracker) listKnownNames() []string {
 type callTracker struct {
 	calls map[uint32]*Call
 	lck   sync.RWMutex
+
+	// pending is called with the number of calls whenever it changes.
+	pending func(n int)
 }
 
 func newCallTracker() *callTracker {
@@ -720,9 +891,17 @@ func newCallTracker() *callTracker {
 func (tracker *callTracker) track(sn uint32, call *Call) {
 	tracker.lck.Lock()
 	tracker.calls[sn] = call
+	tracker.changed()
 	tracker.lck.Unlock()
 }
 
+// changed reports the number of calls. tracker must be locked.
+func (tracker *callTracker) changed() {
+	if tracker.pending != nil {
+		tracker.pending(len(tracker.calls))
+	}
+}
+
 func (tracker *callTracker) handleReply(msg *Message) uint32 {
 	serial := msg.Headers[FieldReplySerial].value.(uint32)
 	tracker.lck.RLock()
@@ -765,6 +944,7 @@ func (tracker *callTracker) finalize(sn uint32) {
 	c, ok := tracker.calls[sn]
 	if ok {
 		delete(tracker.calls, sn)
+		tracker.changed()
 		c.ContextCancel()
 	}
 	return
@@ -775,6 +955,7 @@ func (tracker *callTracker) finalizeWithBody(sn uint32, body []interface{}) {
 	c, ok := tracker.calls[sn]
 	if ok {
 		delete(tracker.calls, sn)
+		tracker.changed()
 	}
 	tracker.lck.Unlock()
 	if ok {
@@ -789,6 +970,7 @@ func (tracker *callTracker) finalizeWithError(sn uint32, err error) {
 	c, ok := tracker.calls[sn]
 	if ok {
 		delete(tracker.calls, sn)
+		tracker.changed()
 	}
 	tracker.lck.Unlock()
 	if ok {
@@ -805,6 +987,7 @@ func (tracker *callTracker) finalizeAllWithError(err error) {
 		closedCalls = append(closedCalls, tracker.calls[sn])
 	}
 	tracker.calls = map[uint32]*Call{}
+	tracker.changed()
 	tracker.lck.Unlock()
 	for _, call := range closedCalls {
 		call.Err = err
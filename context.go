@@ -0,0 +1,56 @@
+package dbus
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type contextKey int
+
+const (
+	senderContextKey contextKey = iota
+	messageContextKey
+	peerContextKey
+)
+
+// SenderFromContext returns the sender of the method call that is handled
+// with ctx, as passed to exported methods with a context.Context parameter.
+func SenderFromContext(ctx context.Context) (Sender, bool) {
+	sender, ok := ctx.Value(senderContextKey).(Sender)
+	return sender, ok
+}
+
+// MessageFromContext returns the method call that is handled with ctx.
+func MessageFromContext(ctx context.Context) (*Message, bool) {
+	msg, ok := ctx.Value(messageContextKey).(*Message)
+	return msg, ok
+}
+
+// PeerCredentialsFromContext returns the credentials of the peer that sent the
+// method call that is handled with ctx. As for (*Conn).PeerCredentials, they
+// are only available for connections accepted by a Server.
+func PeerCredentialsFromContext(ctx context.Context) (*PeerCredentials, bool) {
+	creds, ok := ctx.Value(peerContextKey).(*PeerCredentials)
+	return creds, ok
+}
+
+// SetHandlerTimeout sets the time after which the context passed to exported
+// methods is cancelled. If d is zero (the default), it is only cancelled when
+// the method returns or the connection is closed.
+func (conn *Conn) SetHandlerTimeout(d time.Duration) {
+	atomic.StoreInt64(&conn.handlerTimeout, int64(d))
+}
+
+// callContext returns the context for handling msg.
+func (conn *Conn) callContext(msg *Message, sender string) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(conn.ctx, senderContextKey, Sender(sender))
+	ctx = context.WithValue(ctx, messageContextKey, msg)
+	if creds := conn.PeerCredentials(); creds != nil {
+		ctx = context.WithValue(ctx, peerContextKey, creds)
+	}
+	if d := time.Duration(atomic.LoadInt64(&conn.handlerTimeout)); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
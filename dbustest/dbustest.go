@@ -0,0 +1,439 @@
+// Package dbustest provides a scripted fake message bus for unit tests that
+// don't have access to a real one.
+//
+// A test creates a Bus together with a connection to it, states the method
+// calls it expects the code under test to make and the replies they get, and
+// checks with Verify that all of them were made:
+//
+//	b, conn, err := dbustest.New()
+//	...
+//	defer b.Close()
+//	b.ExpectCall("org.example.Service", "/org/example", "org.example.Iface.Get", "key").
+//		Return(uint32(42))
+//	... // code under test that uses conn
+//	if err := b.Verify(); err != nil {
+//		t.Error(err)
+//	}
+//
+// Signals can be sent to the connection with Emit. A session that was
+// recorded with the pcap package can be replayed with NewReplay.
+package dbustest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	busName = "org.freedesktop.DBus"
+	busPath = dbus.ObjectPath("/org/freedesktop/DBus")
+
+	// UniqueName is the unique name of connections returned by New.
+	UniqueName = ":1.1"
+)
+
+// Matcher matches an argument of a method call. Matchers can be passed to
+// ExpectCall instead of the expected values.
+type Matcher func(arg interface{}) bool
+
+// Any returns a Matcher that matches every argument.
+func Any() Matcher {
+	return func(interface{}) bool { return true }
+}
+
+// Expectation is a method call that is expected by a Bus. By default, it is
+// expected exactly once and gets an empty reply.
+type Expectation struct {
+	dest   string
+	path   dbus.ObjectPath
+	method string
+	args   []interface{}
+
+	// the following fields are protected by Bus.mu
+	times   int // -1 for any number
+	calls   int
+	reply   []interface{}
+	errName string
+}
+
+// Return sets the values that are returned to the caller.
+func (e *Expectation) Return(values ...interface{}) *Expectation {
+	e.reply = values
+	e.errName = ""
+	return e
+}
+
+// ReturnError makes the call fail with the error name and the given body,
+// which is usually a single string describing the error.
+func (e *Expectation) ReturnError(name string, body ...interface{}) *Expectation {
+	e.reply = body
+	e.errName = name
+	return e
+}
+
+// Times sets how often the call is expected. If n is negative, the call may
+// be made any number of times, including none.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		if _, ok := arg.(Matcher); ok {
+			args[i] = "<matcher>"
+		} else {
+			args[i] = fmt.Sprintf("%#v", arg)
+		}
+	}
+	return fmt.Sprintf("%s %s %s(%s)", e.dest, e.path, e.method, strings.Join(args, ", "))
+}
+
+// matches reports whether msg is a call described by e.
+func (e *Expectation) matches(msg *dbus.Message) bool {
+	dest, _ := msg.Headers[dbus.FieldDestination].Value().(string)
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+	member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+	if e.dest != "" && e.dest != dest || e.path != "" && e.path != path {
+		return false
+	}
+	if iface != "" && e.method != iface+"."+member ||
+		iface == "" && !strings.HasSuffix(e.method, "."+member) {
+		return false
+	}
+	if len(e.args) != len(msg.Body) {
+		return false
+	}
+	for i, arg := range e.args {
+		if m, ok := arg.(Matcher); ok {
+			if !m(msg.Body[i]) {
+				return false
+			}
+		} else if !reflect.DeepEqual(arg, msg.Body[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// injection is a signal that is sent once all expectations in after were
+// met, which is used to replay recorded signals at the right point.
+type injection struct {
+	msg   *dbus.Message
+	after []*Expectation
+}
+
+// Bus is a fake message bus with a single connection. It answers the method
+// calls of the connection according to the expectations set with ExpectCall
+// and implements just enough of the org.freedesktop.DBus interface (Hello,
+// AddMatch, RemoveMatch and GetNameOwner) to make the connection work. Calls
+// that weren't expected fail and are reported by Verify.
+//
+// It is safe for concurrent use by multiple goroutines.
+type Bus struct {
+	conn *dbus.Conn // the bus side of the connection
+	name string     // the unique name of the client
+
+	sendLck sync.Mutex
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+	injections   []injection
+}
+
+// New returns a new fake bus and a connection to it, which is already
+// authenticated and has the unique name UniqueName.
+func New() (*Bus, *dbus.Conn, error) {
+	return newBus(UniqueName)
+}
+
+func newBus(name string) (*Bus, *dbus.Conn, error) {
+	client, server := net.Pipe()
+	b := &Bus{name: name}
+	authDone := make(chan error, 1)
+	go func() {
+		authDone <- authenticate(server)
+	}()
+
+	conn, err := dbus.NewConnHandler(client, dbus.NewDefaultHandler(), dbus.NewDefaultSignalHandler())
+	if err != nil {
+		client.Close()
+		server.Close()
+		return nil, nil, err
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		server.Close()
+		return nil, nil, err
+	}
+	if err = <-authDone; err != nil {
+		conn.Close()
+		server.Close()
+		return nil, nil, err
+	}
+	if b.conn, err = dbus.NewConn(server); err != nil {
+		conn.Close()
+		server.Close()
+		return nil, nil, err
+	}
+	go b.serve()
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		b.Close()
+		return nil, nil, err
+	}
+	return b, conn, nil
+}
+
+// Close closes the bus and thereby the connection to it.
+func (b *Bus) Close() error {
+	return b.conn.Close()
+}
+
+// ExpectCall adds an expected method call of method (in interface.member
+// notation) on the object path of dest. If dest or path is empty, any
+// destination or path matches. The arguments are compared with
+// reflect.DeepEqual unless they are Matchers. Expectations are matched in the
+// order in which they were added.
+func (b *Bus) ExpectCall(dest string, path dbus.ObjectPath, method string, args ...interface{}) *Expectation {
+	e := &Expectation{dest: dest, path: path, method: method, args: args, times: 1}
+	b.mu.Lock()
+	b.expectations = append(b.expectations, e)
+	b.mu.Unlock()
+	return e
+}
+
+// Emit sends a signal from sender to the connection. The name parameter must
+// be formatted as "interface.member".
+func (b *Bus) Emit(sender string, path dbus.ObjectPath, name string, values ...interface{}) error {
+	i := strings.LastIndex(name, ".")
+	if i == -1 {
+		return errors.New("dbustest: invalid signal name")
+	}
+	msg := &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:    dbus.MakeVariant(sender),
+			dbus.FieldPath:      dbus.MakeVariant(path),
+			dbus.FieldInterface: dbus.MakeVariant(name[:i]),
+			dbus.FieldMember:    dbus.MakeVariant(name[i+1:]),
+		},
+		Body: values,
+	}
+	if len(values) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(values...))
+	}
+	return b.send(msg)
+}
+
+// Verify returns an error that lists the calls that were expected but not
+// made and the calls that were made but not expected, if there are any.
+func (b *Bus) Verify() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var problems []string
+	for _, e := range b.expectations {
+		if e.times >= 0 && e.calls < e.times {
+			problems = append(problems, fmt.Sprintf("missing call %v (called %d of %d times)", e, e.calls, e.times))
+		}
+	}
+	for _, call := range b.unexpected {
+		problems = append(problems, "unexpected call "+call)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("dbustest: " + strings.Join(problems, "; "))
+}
+
+func (b *Bus) send(msg *dbus.Message) error {
+	b.sendLck.Lock()
+	defer b.sendLck.Unlock()
+	return b.conn.Send(msg, nil).Err
+}
+
+// serve runs in an own goroutine, answering the method calls of the
+// connection.
+func (b *Bus) serve() {
+	for {
+		msg, err := b.conn.ReadMessage()
+		if err != nil {
+			if _, ok := err.(dbus.InvalidMessageError); ok {
+				continue
+			}
+			b.conn.Close()
+			return
+		}
+		if msg.Type == dbus.TypeMethodCall {
+			b.handleCall(msg)
+		}
+	}
+}
+
+func (b *Bus) handleCall(msg *dbus.Message) {
+	dest, _ := msg.Headers[dbus.FieldDestination].Value().(string)
+	b.mu.Lock()
+	var expectation *Expectation
+	for _, e := range b.expectations {
+		if (e.times < 0 || e.calls < e.times) && e.matches(msg) {
+			expectation = e
+			e.calls++
+			break
+		}
+	}
+	var reply *dbus.Message
+	switch {
+	case expectation != nil && expectation.errName != "":
+		reply = b.errorReply(msg, dest, expectation.errName, expectation.reply...)
+	case expectation != nil:
+		reply = b.reply(msg, dest, expectation.reply...)
+	case dest == busName:
+		reply = b.busCall(msg)
+	}
+	if reply == nil {
+		b.unexpected = append(b.unexpected, callString(msg))
+		reply = b.errorReply(msg, dest, "org.freedesktop.DBus.Error.UnknownMethod",
+			"dbustest: unexpected call "+callString(msg))
+	}
+	b.mu.Unlock()
+
+	if msg.Flags&dbus.FlagNoReplyExpected == 0 {
+		b.send(reply)
+	}
+	if expectation != nil {
+		b.inject()
+	}
+}
+
+// busCall answers the methods of org.freedesktop.DBus that connections use
+// implicitly. It returns nil for other methods.
+func (b *Bus) busCall(msg *dbus.Message) *dbus.Message {
+	member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+	switch member {
+	case "Hello":
+		return b.reply(msg, busName, b.name)
+	case "AddMatch", "RemoveMatch":
+		return b.reply(msg, busName)
+	case "GetNameOwner":
+		return b.errorReply(msg, busName, "org.freedesktop.DBus.Error.NameHasNoOwner", "dbustest: no owners are known")
+	}
+	return nil
+}
+
+// inject sends the pending injections whose expectations were met, keeping
+// their order.
+func (b *Bus) inject() {
+	for {
+		b.mu.Lock()
+		if len(b.injections) == 0 {
+			b.mu.Unlock()
+			return
+		}
+		next := b.injections[0]
+		for _, e := range next.after {
+			if e.calls < e.times {
+				b.mu.Unlock()
+				return
+			}
+		}
+		b.injections = b.injections[1:]
+		b.mu.Unlock()
+		b.send(next.msg)
+	}
+}
+
+// reply creates a reply from sender to the method call msg.
+func (b *Bus) reply(msg *dbus.Message, sender string, body ...interface{}) *dbus.Message {
+	reply := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldDestination: dbus.MakeVariant(b.name),
+			dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+		},
+		Body: body,
+	}
+	if sender != "" {
+		reply.Headers[dbus.FieldSender] = dbus.MakeVariant(sender)
+	}
+	if len(body) > 0 {
+		reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(body...))
+	}
+	return reply
+}
+
+// errorReply creates an error reply from sender to the method call msg.
+func (b *Bus) errorReply(msg *dbus.Message, sender, name string, body ...interface{}) *dbus.Message {
+	reply := b.reply(msg, sender, body...)
+	reply.Type = dbus.TypeError
+	reply.Headers[dbus.FieldErrorName] = dbus.MakeVariant(name)
+	return reply
+}
+
+func callString(msg *dbus.Message) string {
+	dest, _ := msg.Headers[dbus.FieldDestination].Value().(string)
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+	member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+	args := make([]string, len(msg.Body))
+	for i, arg := range msg.Body {
+		args[i] = fmt.Sprintf("%#v", arg)
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", dest, path, iface, member, strings.Join(args, ", "))
+}
+
+// authenticate runs the server side of the authentication protocol on rw and
+// accepts the EXTERNAL and ANONYMOUS mechanisms without checking anything.
+func authenticate(rw io.ReadWriter) error {
+	var b [1]byte
+	if _, err := io.ReadFull(rw, b[:]); err != nil {
+		return err
+	}
+	const guid = "00000000000000000000000000000000"
+	for {
+		line, err := readLine(rw)
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		var answer string
+		switch {
+		case len(fields) >= 2 && fields[0] == "AUTH" && (fields[1] == "EXTERNAL" || fields[1] == "ANONYMOUS"):
+			answer = "OK " + guid
+		case len(fields) >= 1 && (fields[0] == "AUTH" || fields[0] == "CANCEL"):
+			answer = "REJECTED EXTERNAL ANONYMOUS"
+		case len(fields) == 1 && fields[0] == "BEGIN":
+			return nil
+		default:
+			answer = "ERROR"
+		}
+		if _, err := io.WriteString(rw, answer+"\r\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads a line of the authentication protocol byte by byte, so that
+// no data of the messages that follow it is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	var b [1]byte
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+}
@@ -0,0 +1,169 @@
+package dbustest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/pcap"
+)
+
+const (
+	testDest  = "org.example.Service"
+	testPath  = dbus.ObjectPath("/org/example")
+	testIface = "org.example.Iface"
+)
+
+func TestExpectCall(t *testing.T) {
+	b, conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if names := conn.Names(); len(names) == 0 || names[0] != UniqueName {
+		t.Errorf("got names %v, expected %s", names, UniqueName)
+	}
+
+	b.ExpectCall(testDest, testPath, testIface+".Get", "key").Return(uint32(42))
+	b.ExpectCall(testDest, testPath, testIface+".Set", Any(), uint32(1)).Times(2)
+	b.ExpectCall(testDest, testPath, testIface+".Fail").
+		ReturnError("org.example.Error.Failed", "failed")
+
+	obj := conn.Object(testDest, testPath)
+	var v uint32
+	if err := obj.Call(testIface+".Get", 0, "key").Store(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Errorf("got %d, expected 42", v)
+	}
+	for _, key := range []string{"a", "b"} {
+		if err := obj.Call(testIface+".Set", 0, key, uint32(1)).Err; err != nil {
+			t.Error(err)
+		}
+	}
+	err = obj.Call(testIface+".Fail", 0).Err
+	if dbusErr, ok := err.(dbus.Error); !ok || dbusErr.Name != "org.example.Error.Failed" ||
+		!reflect.DeepEqual(dbusErr.Body, []interface{}{"failed"}) {
+		t.Errorf("got error %#v", err)
+	}
+	if err := b.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	b, conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	b.ExpectCall(testDest, testPath, testIface+".Get", "key")
+	obj := conn.Object(testDest, testPath)
+	if err := obj.Call(testIface+".Get", 0, "other").Err; err == nil {
+		t.Error("unexpected call succeeded")
+	}
+	err = b.Verify()
+	if err == nil {
+		t.Fatal("Verify succeeded")
+	}
+	for _, s := range []string{"missing call", "unexpected call", `"other"`} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q doesn't contain %q", err, s)
+		}
+	}
+}
+
+func TestEmit(t *testing.T) {
+	b, conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ch := make(chan *dbus.Signal, 1)
+	conn.Signal(ch)
+	if err := b.Emit(testDest, testPath, testIface+".Changed", "value"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-ch:
+		if sig.Name != testIface+".Changed" || sig.Path != testPath ||
+			!reflect.DeepEqual(sig.Body, []interface{}{"value"}) {
+			t.Errorf("got signal %+v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// record a session with a scripted bus
+	var buf bytes.Buffer
+	w, err := pcap.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ExpectCall(testDest, testPath, testIface+".Get", "key").Return(uint32(42))
+	b.ExpectCall(testDest, testPath, testIface+".Fail").ReturnError("org.example.Error.Failed")
+	ch := make(chan *dbus.Signal, 1)
+	conn.Signal(ch)
+	conn.SetCapture(w.Capture)
+	obj := conn.Object(testDest, testPath)
+	obj.Call(testIface+".Get", 0, "key")
+	if err := b.Emit(testDest, testPath, testIface+".Changed", "value"); err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	obj.Call(testIface+".Fail", 0)
+	conn.SetCapture(nil)
+	b.Close()
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recording starts after Hello, so the replay uses UniqueName
+	r, err := pcap.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, conn, err = NewReplay(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ch = make(chan *dbus.Signal, 1)
+	conn.Signal(ch)
+	obj = conn.Object(testDest, testPath)
+	var v uint32
+	if err := obj.Call(testIface+".Get", 0, "key").Store(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Errorf("got %d, expected 42", v)
+	}
+	select {
+	case sig := <-ch:
+		if sig.Name != testIface+".Changed" || !reflect.DeepEqual(sig.Body, []interface{}{"value"}) {
+			t.Errorf("got signal %+v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+	err = obj.Call(testIface+".Fail", 0).Err
+	if dbusErr, ok := err.(dbus.Error); !ok || dbusErr.Name != "org.example.Error.Failed" {
+		t.Errorf("got error %#v", err)
+	}
+	if err := b.Verify(); err != nil {
+		t.Error(err)
+	}
+}
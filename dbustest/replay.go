@@ -0,0 +1,101 @@
+package dbustest
+
+import (
+	"io"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/pcap"
+)
+
+// NewReplay returns a fake bus that replays a session recorded from the
+// client side, e.g. with pcap.Writer.Capture, and a connection to it.
+//
+// Every method call in the recording that was sent by the client becomes an
+// expectation with its exact arguments, which gets the recorded reply or
+// error. Signals that the client received are sent to the connection as soon
+// as all the calls that were made before them in the recording were made
+// again. Method calls that the client received and messages other than method
+// calls that it sent are ignored. The connection gets the unique name that it
+// had in the recording, or UniqueName if the recording doesn't contain the
+// call to Hello.
+func NewReplay(r *pcap.Reader) (*Bus, *dbus.Conn, error) {
+	var msgs []*dbus.Message
+	for {
+		msg, _, err := r.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// replies maps the serials of the calls to their replies.
+	replies := make(map[uint32]*dbus.Message)
+	for _, msg := range msgs {
+		if !sent(msg) && (msg.Type == dbus.TypeMethodReply || msg.Type == dbus.TypeError) {
+			serial, _ := msg.Headers[dbus.FieldReplySerial].Value().(uint32)
+			replies[serial] = msg
+		}
+	}
+
+	var (
+		name         string
+		expectations []*Expectation
+		injections   []injection
+	)
+	for _, msg := range msgs {
+		switch {
+		case sent(msg) && msg.Type == dbus.TypeMethodCall:
+			dest, _ := msg.Headers[dbus.FieldDestination].Value().(string)
+			path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+			iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+			member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+			reply := replies[msg.Serial()]
+			if dest == busName {
+				switch member {
+				case "Hello":
+					if reply != nil && len(reply.Body) == 1 {
+						name, _ = reply.Body[0].(string)
+					}
+					continue
+				case "AddMatch", "RemoveMatch":
+					continue
+				}
+			}
+			e := &Expectation{dest: dest, path: path, method: iface + "." + member, args: msg.Body, times: 1}
+			if reply != nil {
+				e.reply = reply.Body
+				e.errName, _ = reply.Headers[dbus.FieldErrorName].Value().(string)
+			}
+			expectations = append(expectations, e)
+		case !sent(msg) && msg.Type == dbus.TypeSignal:
+			signal := &dbus.Message{Type: msg.Type, Flags: msg.Flags, Headers: msg.Headers, Body: msg.Body}
+			after := make([]*Expectation, len(expectations))
+			copy(after, expectations)
+			injections = append(injections, injection{msg: signal, after: after})
+		}
+	}
+	if name == "" {
+		name = UniqueName
+	}
+
+	b, conn, err := newBus(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.mu.Lock()
+	b.expectations = expectations
+	b.injections = injections
+	b.mu.Unlock()
+	b.inject()
+	return b, conn, nil
+}
+
+// sent reports whether msg was sent by the client, i.e. whether it doesn't
+// have a sender set by the bus.
+func sent(msg *dbus.Message) bool {
+	_, ok := msg.Headers[dbus.FieldSender]
+	return !ok
+}
@@ -3,6 +3,7 @@ package dbus
 import (
 	"bytes"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -15,7 +16,7 @@ func newIntrospectIntf(h *defaultHandler) *exportedIntf {
 			return h.introspectPath(path), nil
 		}),
 	}
-	return newExportedIntf(methods, true)
+	return newExportedIntf(methods, nil, true)
 }
 
 //NewDefaultHandler returns an instance of the default
@@ -41,10 +42,18 @@ func (h *defaultHandler) PathExists(path ObjectPath) bool {
 	return ok
 }
 
+// introspectPath returns the introspection data for path. It contains the
+// interfaces exported on path (or, if there is no object, for the subtree
+// containing path) and the child nodes.
 func (h *defaultHandler) introspectPath(path ObjectPath) string {
+	h.RLock()
+	defer h.RUnlock()
 	subpath := make(map[string]struct{})
 	var xml bytes.Buffer
 	xml.WriteString("<node>")
+	if interfaces := h.interfaces(path); len(interfaces) > 0 {
+		writeInterfaces(&xml, interfaces)
+	}
 	for obj, _ := range h.objects {
 		p := string(path)
 		if p != "/" {
@@ -55,40 +64,64 @@ func (h *defaultHandler) introspectPath(path ObjectPath) string {
 			subpath[node_name] = struct{}{}
 		}
 	}
+	nodes := make([]string, 0, len(subpath))
 	for s, _ := range subpath {
+		nodes = append(nodes, s)
+	}
+	sort.Strings(nodes)
+	for _, s := range nodes {
 		xml.WriteString("\n\t<node name=\"" + s + "\"/>")
 	}
 	xml.WriteString("\n</node>")
 	return xml.String()
 }
 
-func (h *defaultHandler) LookupObject(path ObjectPath) (ServerObject, bool) {
-	h.RLock()
-	defer h.RUnlock()
-	object, ok := h.objects[path]
-	if ok {
-		return object, ok
+// interfaces returns the interfaces exported on path or, if there is no
+// object on path, the ones that were exported for a subtree containing it.
+// h must be locked.
+func (h *defaultHandler) interfaces(path ObjectPath) map[string]*exportedIntf {
+	interfaces := make(map[string]*exportedIntf)
+	if object, ok := h.objects[path]; ok {
+		object.mu.RLock()
+		for name, iface := range object.interfaces {
+			interfaces[name] = iface
+		}
+		object.mu.RUnlock()
+		return interfaces
 	}
 
 	// If an object wasn't found for this exact path,
 	// look for a matching subtree registration
-	subtreeObject := newExportedObject()
 	path = path[:strings.LastIndex(string(path), "/")]
 	for len(path) > 0 {
-		object, ok = h.objects[path]
+		object, ok := h.objects[path]
 		if ok {
+			object.mu.RLock()
 			for name, iface := range object.interfaces {
 				// Only include this handler if it registered for the subtree
 				if iface.isFallbackInterface() {
-					subtreeObject.interfaces[name] = iface
+					interfaces[name] = iface
 				}
 			}
+			object.mu.RUnlock()
 			break
 		}
 
 		path = path[:strings.LastIndex(string(path), "/")]
 	}
+	return interfaces
+}
 
+func (h *defaultHandler) LookupObject(path ObjectPath) (ServerObject, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	object, ok := h.objects[path]
+	if ok {
+		return object, ok
+	}
+
+	subtreeObject := newExportedObject()
+	subtreeObject.interfaces = h.interfaces(path)
 	for name, intf := range h.defaultIntf {
 		if _, exists := subtreeObject.interfaces[name]; exists {
 			continue
@@ -101,6 +134,7 @@ func (h *defaultHandler) LookupObject(path ObjectPath) (ServerObject, bool) {
 
 func (h *defaultHandler) AddObject(path ObjectPath, object *exportedObj) {
 	h.Lock()
+	object.defaults = h.defaultIntf
 	h.objects[path] = object
 	h.Unlock()
 }
@@ -163,6 +197,10 @@ func newExportedObject() *exportedObj {
 type exportedObj struct {
 	mu         sync.RWMutex
 	interfaces map[string]*exportedIntf
+
+	// Interfaces of the handler (like org.freedesktop.DBus.Introspectable)
+	// that are used if they aren't exported on the object itself.
+	defaults map[string]*exportedIntf
 }
 
 func (obj *exportedObj) LookupInterface(name string) (Interface, bool) {
@@ -172,6 +210,9 @@ func (obj *exportedObj) LookupInterface(name string) (Interface, bool) {
 	obj.mu.RLock()
 	defer obj.mu.RUnlock()
 	intf, exists := obj.interfaces[name]
+	if !exists {
+		intf, exists = obj.defaults[name]
+	}
 	return intf, exists
 }
 
@@ -196,6 +237,12 @@ func (obj *exportedObj) LookupMethod(name string) (Method, bool) {
 			return method, exists
 		}
 	}
+	for _, intf := range obj.defaults {
+		method, exists := intf.LookupMethod(name)
+		if exists {
+			return method, exists
+		}
+	}
 	return nil, false
 }
 
@@ -203,9 +250,10 @@ func (obj *exportedObj) isFallbackInterface() bool {
 	return false
 }
 
-func newExportedIntf(methods map[string]Method, includeSubtree bool) *exportedIntf {
+func newExportedIntf(methods map[string]Method, value interface{}, includeSubtree bool) *exportedIntf {
 	return &exportedIntf{
 		methods:        methods,
+		value:          value,
 		includeSubtree: includeSubtree,
 	}
 }
@@ -213,6 +261,9 @@ func newExportedIntf(methods map[string]Method, includeSubtree bool) *exportedIn
 type exportedIntf struct {
 	methods map[string]Method
 
+	// The value passed to Export, if any
+	value interface{}
+
 	// Whether or not this export is for the entire subtree
 	includeSubtree bool
 }
@@ -231,7 +282,7 @@ func (obj *exportedIntf) isFallbackInterface() bool {
 //one of the two handlers but not both.
 func NewDefaultSignalHandler() *defaultSignalHandler {
 	return &defaultSignalHandler{
-		closeChan: make(chan struct{}),
+		queues: make(map[chan<- *Signal]*signalQueue),
 	}
 }
 
@@ -242,47 +293,64 @@ func isDefaultSignalHandler(handler SignalHandler) bool {
 
 type defaultSignalHandler struct {
 	sync.RWMutex
-	closed    bool
-	signals   []chan<- *Signal
-	closeChan chan struct{}
+	closed        bool
+	signals       []chan<- *Signal
+	subscriptions []*Subscription
+	queues        map[chan<- *Signal]*signalQueue
+
+	// dropped is called when a queue discards a signal.
+	dropped func()
 }
 
 func (sh *defaultSignalHandler) DeliverSignal(intf, name string, signal *Signal) {
-	go func() {
-		sh.RLock()
-		defer sh.RUnlock()
-		if sh.closed {
-			return
+	sh.RLock()
+	if sh.closed {
+		sh.RUnlock()
+		return
+	}
+	targets := make([]*signalQueue, 0, len(sh.signals)+len(sh.subscriptions))
+	// a channel gets every signal at most once, even if it was passed to
+	// Signal and Subscribe or matches multiple subscriptions
+	seen := make(map[*signalQueue]bool, cap(targets))
+	for _, ch := range sh.signals {
+		targets = append(targets, sh.queues[ch])
+		seen[sh.queues[ch]] = true
+	}
+	for _, sub := range sh.subscriptions {
+		sub.filter.update(signal)
+		if q := sh.queues[sub.ch]; sub.filter.matches(signal) && !seen[q] {
+			targets = append(targets, q)
+			seen[q] = true
 		}
-		for _, ch := range sh.signals {
-			select {
-			case ch <- signal:
-			case <-sh.closeChan:
-				return
-			}
+	}
+	sh.RUnlock()
+	for _, q := range targets {
+		if !q.push(signal) {
+			sh.disconnect(q)
 		}
-	}()
+	}
 }
 
 func (sh *defaultSignalHandler) Init() error {
 	sh.Lock()
 	sh.signals = make([]chan<- *Signal, 0)
-	sh.closeChan = make(chan struct{})
+	sh.queues = make(map[chan<- *Signal]*signalQueue)
 	sh.Unlock()
 	return nil
 }
 
 func (sh *defaultSignalHandler) Terminate() {
 	sh.Lock()
-	if !sh.closed {
-		close(sh.closeChan)
-	}
 	sh.closed = true
-	for _, ch := range sh.signals {
-		close(ch)
-	}
+	queues := sh.queues
+	sh.queues = nil
 	sh.signals = nil
+	sh.subscriptions = nil
 	sh.Unlock()
+	for _, q := range queues {
+		q.stop()
+		close(q.ch)
+	}
 }
 
 func (sh *defaultSignalHandler) addSignal(ch chan<- *Signal) {
@@ -292,7 +360,7 @@ func (sh *defaultSignalHandler) addSignal(ch chan<- *Signal) {
 		return
 	}
 	sh.signals = append(sh.signals, ch)
-
+	sh.addQueue(ch)
 }
 
 func (sh *defaultSignalHandler) removeSignal(ch chan<- *Signal) {
@@ -308,4 +376,106 @@ func (sh *defaultSignalHandler) removeSignal(ch chan<- *Signal) {
 			sh.signals = sh.signals[:len(sh.signals)-1]
 		}
 	}
+	sh.releaseQueue(ch)
+}
+
+func (sh *defaultSignalHandler) addSubscription(sub *Subscription) {
+	sh.Lock()
+	defer sh.Unlock()
+	if sh.closed {
+		return
+	}
+	sh.subscriptions = append(sh.subscriptions, sub)
+	sh.addQueue(sub.ch)
+}
+
+func (sh *defaultSignalHandler) removeSubscription(sub *Subscription) {
+	sh.Lock()
+	defer sh.Unlock()
+	for i, s := range sh.subscriptions {
+		if s == sub {
+			copy(sh.subscriptions[i:], sh.subscriptions[i+1:])
+			sh.subscriptions[len(sh.subscriptions)-1] = nil
+			sh.subscriptions = sh.subscriptions[:len(sh.subscriptions)-1]
+			sh.releaseQueue(sub.ch)
+			return
+		}
+	}
+}
+
+// addQueue creates the queue for ch if it doesn't exist yet. sh must be
+// locked.
+func (sh *defaultSignalHandler) addQueue(ch chan<- *Signal) {
+	if sh.queues == nil {
+		sh.queues = make(map[chan<- *Signal]*signalQueue)
+	}
+	if _, ok := sh.queues[ch]; !ok {
+		q := newSignalQueue(ch)
+		q.onDrop = sh.dropped
+		sh.queues[ch] = q
+	}
+}
+
+// releaseQueue stops the queue for ch if ch isn't registered anymore. sh must
+// be locked.
+func (sh *defaultSignalHandler) releaseQueue(ch chan<- *Signal) {
+	q, ok := sh.queues[ch]
+	if !ok {
+		return
+	}
+	for _, c := range sh.signals {
+		if c == ch {
+			return
+		}
+	}
+	for _, sub := range sh.subscriptions {
+		if sub.ch == ch {
+			return
+		}
+	}
+	delete(sh.queues, ch)
+	go q.stop()
+}
+
+// queue returns the queue for ch or nil if ch isn't registered.
+func (sh *defaultSignalHandler) queue(ch chan<- *Signal) *signalQueue {
+	sh.RLock()
+	defer sh.RUnlock()
+	return sh.queues[ch]
+}
+
+// disconnect unregisters the channel of q after its queue overflowed and
+// closes it.
+func (sh *defaultSignalHandler) disconnect(q *signalQueue) {
+	sh.Lock()
+	if sh.closed || sh.queues[q.ch] != q {
+		sh.Unlock()
+		return
+	}
+	delete(sh.queues, q.ch)
+	signals := sh.signals[:0]
+	for _, ch := range sh.signals {
+		if ch != q.ch {
+			signals = append(signals, ch)
+		}
+	}
+	sh.signals = signals
+	var subs []*Subscription
+	subscriptions := sh.subscriptions[:0]
+	for _, sub := range sh.subscriptions {
+		if sub.ch == q.ch {
+			subs = append(subs, sub)
+		} else {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	sh.subscriptions = subscriptions
+	sh.Unlock()
+	q.stop()
+	close(q.ch)
+	for _, sub := range subs {
+		// the rule can't be removed synchronously, as the reply is read by
+		// the goroutine that delivers signals.
+		go sub.Unsubscribe()
+	}
 }
@@ -0,0 +1,152 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ErrAlreadyReplied is returned by the methods of DeferredReply if the method
+// call has already been replied to.
+var ErrAlreadyReplied = errors.New("dbus: method call has already been replied to")
+
+// errMsgNoReply is sent if an exported method that uses a DeferredReply never
+// replies.
+var errMsgNoReply = Error{
+	"org.freedesktop.DBus.Error.NoReply",
+	[]interface{}{"Method did not send a reply"},
+}
+
+// DeferredReply allows exported methods to reply to a method call after they
+// have returned. If an exported method has a parameter of the type
+// *DeferredReply, it is set when the method is called and, unlike for other
+// methods, no reply is sent when the method returns, except if it returns an
+// error. Instead, Reply or ReplyError must be called exactly once, which may
+// be done from any goroutine. Parameters of this type do not contribute to
+// the dbus signature of the method.
+//
+// If the caller didn't expect a reply, nothing is sent. If a DeferredReply is
+// garbage collected without being used, an
+// org.freedesktop.DBus.Error.NoReply error is sent.
+type DeferredReply struct {
+	conn   *Conn
+	msg    *Message
+	cancel context.CancelFunc
+
+	// used is set if the method has a parameter of the type *DeferredReply.
+	used bool
+
+	// intercepted is set if server interceptors are set. The reply is then
+	// sent to it instead of the caller, see wait. cancel is nil in this case,
+	// as the context is cancelled once wait returns.
+	intercepted chan interceptedReply
+
+	mu      sync.Mutex
+	replied bool
+}
+
+// interceptedReply is the outcome of an intercepted method call.
+type interceptedReply struct {
+	body []interface{}
+	err  error
+}
+
+func newDeferredReply(conn *Conn, msg *Message, cancel context.CancelFunc) *DeferredReply {
+	return &DeferredReply{conn: conn, msg: msg, cancel: cancel}
+}
+
+// Reply sends a method reply with the given values as its body.
+func (r *DeferredReply) Reply(values ...interface{}) error {
+	if !r.finish() {
+		return ErrAlreadyReplied
+	}
+	if r.intercepted != nil {
+		r.intercepted <- interceptedReply{body: values}
+		return nil
+	}
+	if r.msg.Flags&FlagNoReplyExpected == 0 {
+		sender, _ := r.msg.Headers[FieldSender].value.(string)
+		r.conn.sendReply(sender, r.msg.serial, values...)
+	}
+	return nil
+}
+
+// ReplyError sends err as an error reply. It is converted as if it were
+// returned by the exported method.
+func (r *DeferredReply) ReplyError(err error) error {
+	if !r.finish() {
+		return ErrAlreadyReplied
+	}
+	if r.intercepted != nil {
+		r.intercepted <- interceptedReply{err: err}
+		return nil
+	}
+	sender, _ := r.msg.Headers[FieldSender].value.(string)
+	r.conn.sendError(err, sender, r.msg.serial)
+	return nil
+}
+
+// finish marks the call as replied to and cancels its context. It returns
+// false if it was already replied to.
+func (r *DeferredReply) finish() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replied {
+		return false
+	}
+	r.replied = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+	runtime.SetFinalizer(r, nil)
+	return true
+}
+
+// watch arranges for an error to be sent if r is never used.
+func (r *DeferredReply) watch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.replied {
+		runtime.SetFinalizer(r, (*DeferredReply).abandon)
+	}
+}
+
+// wait returns the outcome of an intercepted call once r was replied to or
+// ctx is done. err is the error returned by the method.
+func (r *DeferredReply) wait(ctx context.Context, err error) ([]interface{}, error) {
+	if err != nil && r.finish() {
+		return nil, err
+	}
+	// r must not be referenced while waiting, so that it is garbage collected
+	// if the method drops it
+	intercepted, closed := r.intercepted, r.conn.ctx.Done()
+	r.watch()
+	select {
+	case reply := <-intercepted:
+		return reply.body, reply.err
+	case <-ctx.Done():
+	}
+	select {
+	case reply := <-intercepted:
+		return reply.body, reply.err
+	case <-closed:
+		return nil, ErrClosed
+	default:
+		return nil, ctx.Err()
+	}
+}
+
+func (r *DeferredReply) abandon() {
+	if !r.finish() {
+		return
+	}
+	if r.intercepted != nil {
+		r.intercepted <- interceptedReply{err: errMsgNoReply}
+		return
+	}
+	if r.msg.Flags&FlagNoReplyExpected == 0 {
+		sender, _ := r.msg.Headers[FieldSender].value.(string)
+		r.conn.sendError(errMsgNoReply, sender, r.msg.serial)
+	}
+}
@@ -0,0 +1,155 @@
+package dbus
+
+import "sync"
+
+// CallOrdering determines which incoming method calls are handled one after
+// another.
+type CallOrdering int
+
+const (
+	// UnorderedCalls handles all calls concurrently. This is the default.
+	UnorderedCalls CallOrdering = iota
+
+	// OrderBySender handles the calls from one sender one after another, in
+	// the order in which they were received.
+	OrderBySender
+
+	// OrderByPath handles the calls to one object one after another, in the
+	// order in which they were received.
+	OrderByPath
+)
+
+// errMsgLimitsExceeded is sent for method calls that are rejected because the
+// queue of the dispatcher is full.
+var errMsgLimitsExceeded = Error{
+	"org.freedesktop.DBus.Error.LimitsExceeded",
+	[]interface{}{"Too many method calls are pending"},
+}
+
+// callDispatcher starts the handlers for incoming method calls.
+type callDispatcher struct {
+	handle func(*Message)
+
+	mu          sync.Mutex
+	maxHandlers int
+	queueSize   int
+	ordering    CallOrdering
+	running     int
+	queue       []*Message
+	busy        map[string]bool
+	closed      bool
+}
+
+func newCallDispatcher(handle func(*Message)) *callDispatcher {
+	return &callDispatcher{handle: handle, busy: make(map[string]bool)}
+}
+
+func (d *callDispatcher) configure(maxHandlers, queueSize int, ordering CallOrdering) {
+	if maxHandlers < 0 {
+		maxHandlers = 0
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxHandlers = maxHandlers
+	d.queueSize = queueSize
+	d.ordering = ordering
+	d.schedule()
+}
+
+// key returns the key of the calls that must not be handled concurrently
+// with msg or "" if there is no such restriction.
+func (d *callDispatcher) key(msg *Message) string {
+	switch d.ordering {
+	case OrderBySender:
+		sender, _ := msg.Headers[FieldSender].value.(string)
+		return "s" + sender
+	case OrderByPath:
+		path, _ := msg.Headers[FieldPath].value.(ObjectPath)
+		return "p" + string(path)
+	}
+	return ""
+}
+
+// dispatch queues msg and starts a handler for it as soon as possible. It
+// returns false if msg was rejected because the queue is full. It never
+// blocks, as the goroutine that calls it must go on reading the replies to
+// the calls that the handlers make.
+func (d *callDispatcher) dispatch(msg *Message) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return true
+	}
+	d.queue = append(d.queue, msg)
+	d.schedule()
+	if n := len(d.queue); n > d.queueSize && d.queue[n-1] == msg {
+		d.queue[n-1] = nil
+		d.queue = d.queue[:n-1]
+		return false
+	}
+	return true
+}
+
+// schedule starts handlers for the queued calls that may be handled now. d.mu
+// must be held.
+func (d *callDispatcher) schedule() {
+	queue := d.queue[:0]
+	for i, msg := range d.queue {
+		if d.closed || (d.maxHandlers > 0 && d.running >= d.maxHandlers) {
+			queue = append(queue, d.queue[i:]...)
+			break
+		}
+		key := d.key(msg)
+		if key != "" && d.busy[key] {
+			queue = append(queue, msg)
+			continue
+		}
+		if key != "" {
+			d.busy[key] = true
+		}
+		d.running++
+		go d.run(msg, key)
+	}
+	for i := len(queue); i < len(d.queue); i++ {
+		d.queue[i] = nil
+	}
+	d.queue = queue
+}
+
+func (d *callDispatcher) run(msg *Message, key string) {
+	d.handle(msg)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running--
+	if key != "" {
+		delete(d.busy, key)
+	}
+	d.schedule()
+}
+
+// close discards the queued calls.
+func (d *callDispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	d.queue = nil
+}
+
+// SetCallDispatch configures how incoming method calls are handled. At most
+// maxHandlers calls are handled concurrently (0 means no limit). ordering
+// determines which calls are handled one after another. Calls that can't be
+// handled yet are queued; if queueSize calls are queued already, further
+// calls are rejected with an org.freedesktop.DBus.Error.LimitsExceeded error
+// until a handler finishes. Messages are still read from the connection
+// meanwhile, so that handlers can make calls themselves. With a queueSize of
+// 0, every call that can't be handled immediately is rejected, e.g. the
+// second call from a sender with OrderBySender, so a queueSize of at least 1
+// should be used with a limit or an ordering.
+//
+// By default, there is no limit and all calls are handled concurrently.
+func (conn *Conn) SetCallDispatch(maxHandlers, queueSize int, ordering CallOrdering) {
+	conn.dispatcher.configure(maxHandlers, queueSize, ordering)
+}
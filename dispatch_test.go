@@ -0,0 +1,155 @@
+package dbus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func dispatchMessage(sender string, n int) *Message {
+	return &Message{
+		Type: TypeMethodCall,
+		Headers: map[HeaderField]Variant{
+			FieldSender: MakeVariant(sender),
+			FieldPath:   MakeVariant(ObjectPath("/")),
+			FieldMember: MakeVariant("Test"),
+		},
+		Body: []interface{}{n},
+	}
+}
+
+func TestCallDispatcherLimit(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		max     int
+		wg      sync.WaitGroup
+	)
+	d := newCallDispatcher(func(msg *Message) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		wg.Done()
+	})
+	d.configure(3, 100, UnorderedCalls)
+	wg.Add(50)
+	for i := 0; i < 50; i++ {
+		d.dispatch(dispatchMessage(":1.1", i))
+	}
+	wg.Wait()
+	if max > 3 {
+		t.Errorf("%d calls were handled concurrently, expected at most 3", max)
+	}
+}
+
+func TestCallDispatcherOrderBySender(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]int)
+		wg       sync.WaitGroup
+	)
+	d := newCallDispatcher(func(msg *Message) {
+		sender := msg.Headers[FieldSender].value.(string)
+		mu.Lock()
+		received[sender] = append(received[sender], msg.Body[0].(int))
+		mu.Unlock()
+		wg.Done()
+	})
+	d.configure(0, 1000, OrderBySender)
+	wg.Add(200)
+	for i := 0; i < 100; i++ {
+		d.dispatch(dispatchMessage(":1.1", i))
+		d.dispatch(dispatchMessage(":1.2", i))
+	}
+	wg.Wait()
+	for sender, calls := range received {
+		for i, n := range calls {
+			if n != i {
+				t.Fatalf("calls from %s handled in order %v", sender, calls)
+			}
+		}
+	}
+}
+
+func TestCallDispatcherQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	d := newCallDispatcher(func(msg *Message) {
+		<-release
+		wg.Done()
+	})
+	d.configure(1, 1, UnorderedCalls)
+	// the first call is handled, the second one queued
+	wg.Add(2)
+	if !d.dispatch(dispatchMessage(":1.1", 0)) || !d.dispatch(dispatchMessage(":1.1", 1)) {
+		t.Fatal("call rejected before the queue was full")
+	}
+	if d.dispatch(dispatchMessage(":1.1", 2)) {
+		t.Fatal("call accepted while the queue was full")
+	}
+	close(release)
+	wg.Wait()
+	wg.Add(1)
+	if !d.dispatch(dispatchMessage(":1.1", 3)) {
+		t.Error("call rejected after the handlers finished")
+	}
+	wg.Wait()
+}
+
+type callingExport struct {
+	conn    *Conn
+	release chan struct{}
+}
+
+func (e callingExport) ListNames() ([]string, *Error) {
+	var names []string
+	if err := e.conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, MakeFailedError(err)
+	}
+	<-e.release
+	return names, nil
+}
+
+func TestSetCallDispatch(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	server.SetCallDispatch(1, 1, OrderBySender)
+	export := callingExport{server, make(chan struct{})}
+	server.Export(export, "/org/guelfey/DBus/Dispatch", "org.guelfey.DBus.Test")
+	obj := client.Object(server.Names()[0], "/org/guelfey/DBus/Dispatch")
+	// the first handler makes a call while the second call is queued and
+	// the third one is rejected
+	var calls []*Call
+	for i := 0; i < 3; i++ {
+		calls = append(calls, obj.Go("org.guelfey.DBus.Test.ListNames", 0, nil))
+	}
+	select {
+	case <-calls[2].Done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call 2 not rejected")
+	}
+	close(export.release)
+	for i, call := range calls[:2] {
+		select {
+		case <-call.Done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("call %d not done", i)
+		}
+		if call.Err != nil {
+			t.Errorf("call %d failed: %v", i, call.Err)
+		}
+	}
+	if e, ok := calls[2].Err.(Error); !ok || e.Name != errMsgLimitsExceeded.Name {
+		t.Errorf("call 2 returned %v, expected LimitsExceeded", calls[2].Err)
+	}
+}
@@ -11,7 +11,12 @@ import (
 
 // Marshall encodes the values into dbus wire format.
 func Marshall(vs ...interface{}) ([]byte, error) {
-	e := newEncoder()
+	return marshal(binary.BigEndian, vs...)
+}
+
+// marshal encodes the values into dbus wire format in the given byte order.
+func marshal(order binary.ByteOrder, vs ...interface{}) ([]byte, error) {
+	e := newEncoder(order)
 	for _, v := range vs {
 		e.encode(reflect.ValueOf(v))
 		if e.err != nil {
@@ -28,6 +33,7 @@ var encoderPool sync.Pool
 // An encoder encodes values to the D-Bus wire format.
 type encoder struct {
 	bytes.Buffer
+	order  binary.ByteOrder
 	offset int
 	err    error
 }
@@ -59,14 +65,14 @@ func (enc *encoder) WriteByte(b byte) {
 
 // NewEncoder returns a new encoder that writes to out in the given
 // byte order.
-func newEncoder() *encoder {
-	return newEncoderAtOffset(0)
+func newEncoder(order binary.ByteOrder) *encoder {
+	return newEncoderAtOffset(0, order)
 }
 
 // newEncoderAtOffset returns a new encoder that writes to out in the given
 // byte order. Specify the offset to initialize pos for proper alignment
 // computation.
-func newEncoderAtOffset(offset int) *encoder {
+func newEncoderAtOffset(offset int, order binary.ByteOrder) *encoder {
 	var e *encoder
 	if v := encoderPool.Get(); v != nil {
 		e = v.(*encoder)
@@ -76,6 +82,7 @@ func newEncoderAtOffset(offset int) *encoder {
 		e = new(encoder)
 	}
 	e.offset = offset
+	e.order = order
 	return e
 }
 
@@ -126,7 +133,8 @@ func getEncoder(t reflect.Type, depth int) encodeFn {
 	case reflect.String:
 		return getStringEncoder(t)
 	case reflect.Ptr:
-		return getEncoder(t.Elem(), depth)
+		f := getEncoder(t.Elem(), depth)
+		return func(enc *encoder, v reflect.Value) { f(enc, v.Elem()) }
 	case reflect.Slice, reflect.Array:
 		return encodeSlice
 	case reflect.Struct:
@@ -162,15 +170,22 @@ func encodeInt(enc *encoder, v reflect.Value) {
 		u = uint64(v.Int())
 		b = v.Type().Bits()
 	}
-	binary.BigEndian.PutUint64(buf, u)
 	sizeBytes := b >> 3
-	enc.Write(buf[8-sizeBytes:])
+	switch sizeBytes {
+	case 2:
+		enc.order.PutUint16(buf, uint16(u))
+	case 4:
+		enc.order.PutUint32(buf, uint32(u))
+	default:
+		enc.order.PutUint64(buf, u)
+	}
+	enc.Write(buf[:sizeBytes])
 }
 
 func encodeFloat(enc *encoder, v reflect.Value) {
 	bits := math.Float64bits(v.Float())
 	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, bits)
+	enc.order.PutUint64(buf, bits)
 	enc.Write(buf)
 }
 
@@ -198,7 +213,7 @@ func encodeStringData(enc *encoder, v reflect.Value) {
 }
 
 func encodeSlice(enc *encoder, v reflect.Value) {
-	temp := newEncoderAtOffset(enc.totalLen() + 4)
+	temp := newEncoderAtOffset(enc.totalLen()+4, enc.order)
 	for i := 0; i < v.Len(); i++ {
 		temp.encode(v.Index(i))
 	}
@@ -230,7 +245,7 @@ func encodeVariant(enc *encoder, v reflect.Value) {
 }
 
 func encodeMap(enc *encoder, v reflect.Value) {
-	tempEnc := newEncoder()
+	tempEnc := newEncoder(enc.order)
 	for _, k := range v.MapKeys() {
 		kv := v.MapIndex(k)
 		tempEnc.align(8)
@@ -2,6 +2,7 @@ package dbus
 
 import (
 	"bytes"
+	"encoding/binary"
 	"flag"
 	"io/ioutil"
 	"math"
@@ -83,7 +84,7 @@ func TestEncode(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		enc := newEncoder()
+		enc := newEncoder(binary.BigEndian)
 		enc.encode(test.in)
 		if enc.err != nil {
 			t.Errorf("%s: encoder err: %s", test.name, enc.err)
@@ -101,3 +102,38 @@ func TestEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeMessageByteOrder(t *testing.T) {
+	msg := &Message{
+		Type: TypeSignal,
+		Headers: map[HeaderField]Variant{
+			FieldPath:      MakeVariant(ObjectPath("/org/guelfey/DBus/Test")),
+			FieldInterface: MakeVariant("org.guelfey.DBus.Test"),
+			FieldMember:    MakeVariant("Signal"),
+			FieldSignature: MakeVariant(SignatureOf("text", uint32(1), int64(-2), 1.5)),
+		},
+		Body: []interface{}{"text", uint32(1), int64(-2), 1.5},
+	}
+	for _, test := range []struct {
+		order binary.ByteOrder
+		first byte
+	}{
+		{binary.LittleEndian, 'l'},
+		{binary.BigEndian, 'B'},
+	} {
+		buf := new(bytes.Buffer)
+		if err := msg.EncodeTo(buf, test.order); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Bytes()[0] != test.first {
+			t.Errorf("%v: got byte order %q, expected %q", test.order, buf.Bytes()[0], test.first)
+		}
+		decoded, err := DecodeMessage(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded.Body, msg.Body) {
+			t.Errorf("%v: got body %v, expected %v", test.order, decoded.Body, msg.Body)
+		}
+	}
+}
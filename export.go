@@ -1,6 +1,7 @@
 package dbus
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -69,18 +70,33 @@ func getMethods(in interface{}, mapping map[string]string) map[string]reflect.Va
 	return methods
 }
 
-func standardMethodArgumentDecode(m Method, sender string, msg *Message, body []interface{}) ([]interface{}, error) {
+// argumentType returns the type of the i-th argument of m. ArgumentValue
+// can't be used for exported methods, as it is nil for interface types like
+// context.Context.
+func argumentType(m Method, i int) reflect.Type {
+	if em, ok := m.(exportedMethod); ok {
+		return em.Type().In(i)
+	}
+	return reflect.TypeOf(m.ArgumentValue(i))
+}
+
+func standardMethodArgumentDecode(ctx context.Context, m Method, sender string, msg *Message, reply *DeferredReply, body []interface{}) ([]interface{}, error) {
 	pointers := make([]interface{}, m.NumArguments())
 	decode := make([]interface{}, 0, len(body))
 
 	for i := 0; i < m.NumArguments(); i++ {
-		tp := reflect.TypeOf(m.ArgumentValue(i))
+		tp := argumentType(m, i)
 		val := reflect.New(tp)
 		pointers[i] = val.Interface()
 		if tp == reflect.TypeOf((*Sender)(nil)).Elem() {
 			val.Elem().SetString(sender)
 		} else if tp == reflect.TypeOf((*Message)(nil)).Elem() {
 			val.Elem().Set(reflect.ValueOf(*msg))
+		} else if tp == reflect.TypeOf((*context.Context)(nil)).Elem() {
+			val.Elem().Set(reflect.ValueOf(ctx))
+		} else if tp == reflect.TypeOf((*DeferredReply)(nil)) {
+			val.Elem().Set(reflect.ValueOf(reply))
+			reply.used = true
 		} else {
 			decode = append(decode, pointers[i])
 		}
@@ -97,82 +113,98 @@ func standardMethodArgumentDecode(m Method, sender string, msg *Message, body []
 	return pointers, nil
 }
 
-func (conn *Conn) decodeArguments(m Method, sender string, msg *Message) ([]interface{}, error) {
+func (conn *Conn) decodeArguments(ctx context.Context, m Method, sender string, msg *Message, reply *DeferredReply) ([]interface{}, error) {
 	if decoder, ok := m.(ArgumentDecoder); ok {
 		return decoder.DecodeArguments(conn, sender, msg, msg.Body)
 	}
-	return standardMethodArgumentDecode(m, sender, msg, msg.Body)
+	return standardMethodArgumentDecode(ctx, m, sender, msg, reply, msg.Body)
 }
 
 // handleCall handles the given method call (i.e. looks if it's one of the
 // pre-implemented ones and searches for a corresponding handler if not).
 func (conn *Conn) handleCall(msg *Message) {
+	sender, _ := msg.Headers[FieldSender].value.(string)
+	ctx, cancel := conn.callContext(msg, sender)
+	var ret []interface{}
+	var err error
+	if interceptors := conn.getServerInterceptors(); interceptors != nil {
+		ret, err = chainInterceptors(interceptors, conn.callIntercepted)(ctx, msg)
+	} else {
+		deferred := newDeferredReply(conn, msg, cancel)
+		ret, err = conn.callMethod(ctx, msg, deferred)
+		if deferred.used {
+			// the method replies (or already replied) with the DeferredReply
+			if err != nil {
+				deferred.ReplyError(err)
+			}
+			deferred.watch()
+			return
+		}
+	}
+	cancel()
+	if err != nil {
+		conn.sendError(err, sender, msg.serial)
+		return
+	}
+	if msg.Flags&FlagNoReplyExpected == 0 {
+		conn.sendReply(sender, msg.serial, ret...)
+	}
+}
+
+// callIntercepted is the last handler in the chain of server interceptors. If
+// the method uses a DeferredReply, it waits until it is replied to.
+func (conn *Conn) callIntercepted(ctx context.Context, msg *Message) ([]interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deferred := newDeferredReply(conn, msg, nil)
+	deferred.intercepted = make(chan interceptedReply, 1)
+	ret, err := conn.callMethod(ctx, msg, deferred)
+	if deferred.used {
+		return deferred.wait(ctx, err)
+	}
+	return ret, err
+}
+
+// callMethod calls the method that handles msg and returns the values it
+// returned.
+func (conn *Conn) callMethod(ctx context.Context, msg *Message, deferred *DeferredReply) ([]interface{}, error) {
 	name := msg.Headers[FieldMember].value.(string)
 	path := msg.Headers[FieldPath].value.(ObjectPath)
 	ifaceName, _ := msg.Headers[FieldInterface].value.(string)
-	sender, hasSender := msg.Headers[FieldSender].value.(string)
-	serial := msg.serial
+	sender, _ := msg.Headers[FieldSender].value.(string)
 	if ifaceName == "org.freedesktop.DBus.Peer" {
 		switch name {
 		case "Ping":
-			conn.sendReply(sender, serial)
+			return nil, nil
 		case "GetMachineId":
-			conn.sendReply(sender, serial, conn.uuid)
-		default:
-			conn.sendError(ErrMsgUnknownMethod, sender, serial)
+			return []interface{}{conn.uuid}, nil
 		}
-		return
+		return nil, ErrMsgUnknownMethod
 	}
 	if len(name) == 0 {
-		conn.sendError(ErrMsgUnknownMethod, sender, serial)
+		return nil, ErrMsgUnknownMethod
 	}
 
 	object, ok := conn.handler.LookupObject(path)
 	if !ok {
-		conn.sendError(ErrMsgNoObject, sender, serial)
-		return
+		return nil, ErrMsgNoObject
 	}
 
 	iface, exists := object.LookupInterface(ifaceName)
 	if !exists {
-		conn.sendError(ErrMsgUnknownInterface, sender, serial)
-		return
+		return nil, ErrMsgUnknownInterface
 	}
 
 	m, exists := iface.LookupMethod(name)
 	if !exists {
-		conn.sendError(ErrMsgUnknownMethod, sender, serial)
-		return
+		return nil, ErrMsgUnknownMethod
 	}
-	args, err := conn.decodeArguments(m, sender, msg)
+	args, err := conn.decodeArguments(ctx, m, sender, msg, deferred)
 	if err != nil {
-		conn.sendError(err, sender, serial)
-		return
-	}
-
-	ret, err := m.Call(args...)
-	if err != nil {
-		conn.sendError(err, sender, serial)
-		return
+		return nil, err
 	}
 
-	if msg.Flags&FlagNoReplyExpected == 0 {
-		reply := new(Message)
-		reply.Type = TypeMethodReply
-		reply.serial = conn.getSerial()
-		reply.Headers = make(map[HeaderField]Variant)
-		if hasSender {
-			reply.Headers[FieldDestination] = msg.Headers[FieldSender]
-		}
-		reply.Headers[FieldReplySerial] = MakeVariant(msg.serial)
-		reply.Body = make([]interface{}, len(ret))
-		for i := 0; i < len(ret); i++ {
-			reply.Body[i] = ret[i]
-		}
-		reply.Headers[FieldSignature] = MakeVariant(SignatureOf(reply.Body...))
-
-		conn.sendMessage(reply)
-	}
+	return conn.callHandler(m, ifaceName, name, args)
 }
 
 // Emit emits the given signal on the message bus. The name parameter must be
@@ -205,14 +237,11 @@ func (conn *Conn) Emit(path ObjectPath, name string, values ...interface{}) erro
 		msg.Headers[FieldSignature] = MakeVariant(SignatureOf(values...))
 	}
 
-	var closed bool
-	conn.sendMessageAndIfClosed(msg, func() {
-		closed = true
+	var err error
+	conn.sendMessageAndIfClosed(msg, func(e error) {
+		err = e
 	})
-	if closed {
-		return ErrClosed
-	}
-	return nil
+	return err
 }
 
 // Export registers the given value to be exported as an object on the
@@ -233,12 +262,27 @@ func (conn *Conn) Emit(path ObjectPath, name string, values ...interface{}) erro
 // received on the bus. Again, parameters of this type do not contribute to the
 // dbus signature of the method.
 //
+// Parameters of the type context.Context are set to a context that is
+// cancelled when the method returns, the connection is closed or the timeout
+// set with SetHandlerTimeout expires. It carries the sender, the message and
+// the peer credentials (see SenderFromContext, MessageFromContext and
+// PeerCredentialsFromContext) and does not contribute to the dbus signature
+// either.
+//
+// If a method has a parameter of the type *DeferredReply, it can reply after
+// it has returned; see DeferredReply.
+//
 // Every method call is executed in a new goroutine, so the method may be called
-// in multiple goroutines at once.
+// in multiple goroutines at once (see SetCallDispatch).
 //
 // Method calls on the interface org.freedesktop.DBus.Peer will be automatically
 // handled for every object.
 //
+// Unless a value is exported as org.freedesktop.DBus.Introspectable, calls to
+// Introspect return introspection data that is generated from the exported
+// methods. Values that implement Introspector can add signals or properties to
+// it; prop.Properties does this for its properties.
+//
 // Passing nil as the first parameter will cause conn to cease handling calls on
 // the given combination of path and interface.
 //
@@ -253,7 +297,7 @@ func (conn *Conn) Export(v interface{}, path ObjectPath, iface string) error {
 // The keys in the map are the real method names (exported on the struct), and
 // the values are the method names to be exported on DBus.
 func (conn *Conn) ExportWithMap(v interface{}, mapping map[string]string, path ObjectPath, iface string) error {
-	return conn.export(getMethods(v, mapping), path, iface, false)
+	return conn.export(getMethods(v, mapping), v, path, iface, false)
 }
 
 // ExportSubtree works exactly like Export but registers the given value for
@@ -276,7 +320,7 @@ func (conn *Conn) ExportSubtree(v interface{}, path ObjectPath, iface string) er
 // The keys in the map are the real method names (exported on the struct), and
 // the values are the method names to be exported on DBus.
 func (conn *Conn) ExportSubtreeWithMap(v interface{}, mapping map[string]string, path ObjectPath, iface string) error {
-	return conn.export(getMethods(v, mapping), path, iface, true)
+	return conn.export(getMethods(v, mapping), v, path, iface, true)
 }
 
 // ExportMethodTable like Export registers the given methods as an object
@@ -313,22 +357,26 @@ func (conn *Conn) exportMethodTable(methods map[string]interface{}, path ObjectP
 		}
 		out[name] = rval
 	}
-	return conn.export(out, path, iface, includeSubtree)
+	return conn.export(out, nil, path, iface, includeSubtree)
 }
 
 func (conn *Conn) unexport(h *defaultHandler, path ObjectPath, iface string) error {
 	if h.PathExists(path) {
 		obj := h.objects[path]
+		if iface == objectManagerIface {
+			conn.removeObjectManager(path)
+		}
 		obj.DeleteInterface(iface)
 		if len(obj.interfaces) == 0 {
 			h.DeleteObject(path)
 		}
+		conn.objectChanged(path)
 	}
 	return nil
 }
 
 // exportWithMap is the worker function for all exports/registrations.
-func (conn *Conn) export(methods map[string]reflect.Value, path ObjectPath, iface string, includeSubtree bool) error {
+func (conn *Conn) export(methods map[string]reflect.Value, v interface{}, path ObjectPath, iface string, includeSubtree bool) error {
 	h, ok := conn.handler.(*defaultHandler)
 	if !ok {
 		return fmt.Errorf(
@@ -358,7 +406,12 @@ func (conn *Conn) export(methods map[string]reflect.Value, path ObjectPath, ifac
 
 	// Finally, save this handler
 	obj := h.objects[path]
-	obj.AddInterface(iface, newExportedIntf(exportedMethods, includeSubtree))
+	if om, ok := v.(*ObjectManager); ok && iface == objectManagerIface {
+		// set it up before it can be called
+		conn.addObjectManager(path, om)
+	}
+	obj.AddInterface(iface, newExportedIntf(exportedMethods, v, includeSubtree))
+	conn.objectChanged(path)
 
 	return nil
 }
@@ -1,10 +1,15 @@
 package dbus
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
+	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 type lowerCaseExport struct{}
@@ -22,6 +27,51 @@ func (export *fooExport) Foo(message Message, param string) (string, *Error) {
 	return "foo", nil
 }
 
+type contextExport struct{}
+
+func (export contextExport) Who(ctx context.Context, param string) (string, *Error) {
+	sender, _ := SenderFromContext(ctx)
+	if msg, ok := MessageFromContext(ctx); !ok || msg.Body[0] != param {
+		return "", MakeFailedError(fmt.Errorf("message not in context"))
+	}
+	return string(sender), nil
+}
+
+func (export contextExport) Wait(ctx context.Context) (string, *Error) {
+	<-ctx.Done()
+	return ctx.Err().Error(), nil
+}
+
+type deferredExport struct {
+	second chan error
+}
+
+func (export deferredExport) Later(reply *DeferredReply, n int64) *Error {
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		reply.Reply(2 * n)
+		export.second <- reply.Reply(n)
+	}()
+	return nil
+}
+
+func (export deferredExport) Fail(reply *DeferredReply) *Error {
+	return MakeFailedError(fmt.Errorf("failed"))
+}
+
+func (export deferredExport) Never(reply *DeferredReply) *Error {
+	return nil
+}
+
+func (export deferredExport) Slow(ctx context.Context, reply *DeferredReply) *Error {
+	go func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		reply.Reply()
+	}()
+	return nil
+}
+
 type barExport struct{}
 
 func (export barExport) Foo(param string) (string, *Error) {
@@ -72,6 +122,78 @@ func TestExport(t *testing.T) {
 	}
 }
 
+// Test that Exported handlers can obtain a context.
+func TestExport_context(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	server.SetHandlerTimeout(50 * time.Millisecond)
+	server.Export(contextExport{}, "/org/guelfey/DBus/Test", "org.guelfey.DBus.Test")
+	object := client.Object(server.Names()[0], "/org/guelfey/DBus/Test")
+
+	var response string
+	err := object.Call("org.guelfey.DBus.Test.Who", 0, "param").Store(&response)
+	if err != nil {
+		t.Fatalf("Unexpected error calling Who: %s", err)
+	}
+	if response != client.Names()[0] {
+		t.Errorf("Sender was %q, expected %q", response, client.Names()[0])
+	}
+
+	err = object.Call("org.guelfey.DBus.Test.Wait", 0).Store(&response)
+	if err != nil {
+		t.Fatalf("Unexpected error calling Wait: %s", err)
+	}
+	if response != context.DeadlineExceeded.Error() {
+		t.Errorf("Context error was %q, expected %q", response, context.DeadlineExceeded)
+	}
+}
+
+// Test that Exported handlers can reply after returning.
+func TestExport_deferredReply(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	export := deferredExport{make(chan error, 1)}
+	server.Export(export, "/org/guelfey/DBus/Test", "org.guelfey.DBus.Test")
+	object := client.Object(server.Names()[0], "/org/guelfey/DBus/Test")
+
+	var response int64
+	err := object.Call("org.guelfey.DBus.Test.Later", 0, int64(2)).Store(&response)
+	if err != nil {
+		t.Fatalf("Unexpected error calling Later: %s", err)
+	}
+	if response != 4 {
+		t.Errorf("Response was %d, expected 4", response)
+	}
+	if err = <-export.second; err != ErrAlreadyReplied {
+		t.Errorf("Second reply returned %v, expected ErrAlreadyReplied", err)
+	}
+
+	if err = object.Call("org.guelfey.DBus.Test.Fail", 0).Err; err == nil {
+		t.Error("Expected an error from Fail")
+	}
+
+	call := object.Go("org.guelfey.DBus.Test.Never", 0, nil)
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		select {
+		case call = <-call.Done:
+			e, ok := call.Err.(Error)
+			if !ok || e.Name != "org.freedesktop.DBus.Error.NoReply" {
+				t.Errorf("Never returned %v, expected a NoReply error", call.Err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("Missing reply was not detected")
+}
+
 // Test that Exported handlers can obtain raw message.
 func TestExport_message(t *testing.T) {
 	connection, err := SessionBus()
@@ -633,3 +755,96 @@ func TestExportSubPathIntrospection(t *testing.T) {
 		t.Errorf("Unexpected introspection response for %s: %s", invalSubpath, response)
 	}
 }
+
+type signalExport struct{}
+
+func (export signalExport) Count(sender Sender, n uint32) ([]string, bool, *Error) {
+	return nil, false, nil
+}
+
+func (export signalExport) IntrospectInterface(iface string) string {
+	if iface != "org.guelfey.DBus.Test" {
+		return ""
+	}
+	return `<signal name="Changed"><arg type="s"/></signal>`
+}
+
+func TestExportIntrospection(t *testing.T) {
+	connection, err := SessionBus()
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to session bus: %s", err)
+	}
+	const path = "/org/guelfey/DBus/Introspection"
+	name := connection.Names()[0]
+
+	connection.Export(signalExport{}, path, "org.guelfey.DBus.Test")
+	connection.Export(contextExport{}, path, "org.guelfey.DBus.Context")
+	connection.Export(barExport{}, path+"/Child", "org.guelfey.DBus.Test")
+	defer connection.Export(nil, path, "org.guelfey.DBus.Test")
+	defer connection.Export(nil, path, "org.guelfey.DBus.Context")
+	defer connection.Export(nil, path+"/Child", "org.guelfey.DBus.Test")
+
+	var response string
+	err = connection.Object(name, path).Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&response)
+	if err != nil {
+		t.Fatalf("Unexpected error calling Introspect: %s", err)
+	}
+	var node struct {
+		Interfaces []struct {
+			Name    string `xml:"name,attr"`
+			Methods []struct {
+				Name string `xml:"name,attr"`
+				Args []struct {
+					Type      string `xml:"type,attr"`
+					Direction string `xml:"direction,attr"`
+				} `xml:"arg"`
+			} `xml:"method"`
+			Signals []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"signal"`
+		} `xml:"interface"`
+		Children []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"node"`
+	}
+	if err := xml.Unmarshal([]byte(response), &node); err != nil {
+		t.Fatalf("Invalid introspection data %q: %s", response, err)
+	}
+	var names []string
+	for _, intf := range node.Interfaces {
+		names = append(names, intf.Name)
+	}
+	expected := []string{
+		"org.guelfey.DBus.Context",
+		"org.guelfey.DBus.Test",
+		"org.freedesktop.DBus.Introspectable",
+		"org.freedesktop.DBus.Peer",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Unexpected interfaces %v, expected %v", names, expected)
+	}
+	if len(node.Children) != 1 || node.Children[0].Name != "Child" {
+		t.Errorf("Unexpected child nodes %v", node.Children)
+	}
+
+	// Context parameters are not part of the signature
+	who := node.Interfaces[0].Methods[1]
+	if who.Name != "Who" || len(who.Args) != 2 || who.Args[0].Type != "s" || who.Args[0].Direction != "in" {
+		t.Errorf("Unexpected introspection data for Who: %v", who)
+	}
+
+	test := node.Interfaces[1]
+	if len(test.Methods) != 1 || len(test.Methods[0].Args) != 3 {
+		t.Fatalf("Unexpected methods %v", test.Methods)
+	}
+	var sig string
+	for _, arg := range test.Methods[0].Args {
+		sig += arg.Direction + ":" + arg.Type + " "
+	}
+	if sig != "in:u out:as out:b " {
+		t.Errorf("Unexpected arguments for Count: %s", sig)
+	}
+	if len(test.Signals) != 1 || test.Signals[0].Name != "Changed" {
+		t.Errorf("Unexpected signals %v", test.Signals)
+	}
+}
@@ -0,0 +1,205 @@
+// Package expvarmetrics implements dbus.Metrics by publishing the numbers
+// with the expvar package, so that they are served as JSON on /debug/vars.
+//
+// Metrics are published as a map with the following keys, in the manner of
+// Prometheus metrics:
+//
+//	messages_sent, messages_received   number of messages by message type
+//	bytes_sent, bytes_received         number of bytes by message type
+//	call_seconds                       histograms of the latency of outgoing
+//	                                   calls by "interface.member"
+//	call_errors                        number of failed outgoing calls by
+//	                                   "interface.member"
+//	pending_calls                      number of calls waiting for a reply
+//	dropped_signals                    number of discarded signals
+//	dropped_eavesdropped_messages      number of discarded eavesdropped
+//	                                   messages
+//	handler_seconds                    histograms of the execution time of
+//	                                   exported methods by "interface.member"
+//	handler_errors                     number of exported method calls that
+//	                                   returned an error by "interface.member"
+//	handler_panics                     number of exported method calls that
+//	                                   panicked by "interface.member"
+package expvarmetrics
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics implements dbus.Metrics. It may be shared by multiple connections.
+type Metrics struct {
+	vars *expvar.Map
+
+	messagesSent, messagesReceived *expvar.Map
+	bytesSent, bytesReceived       *expvar.Map
+	callSeconds, callErrors        *expvar.Map
+	pendingCalls                   *expvar.Int
+	droppedSignals                 *expvar.Int
+	droppedEavesdropped            *expvar.Int
+	handlerSeconds, handlerErrors  *expvar.Map
+	handlerPanics                  *expvar.Map
+
+	// histogramLck serializes the creation of histograms.
+	histogramLck sync.Mutex
+}
+
+// New returns new Metrics that are published with the given name. Like
+// expvar.Publish, it panics if the name is already in use.
+func New(name string) *Metrics {
+	m := &Metrics{
+		vars:                expvar.NewMap(name),
+		messagesSent:        new(expvar.Map).Init(),
+		messagesReceived:    new(expvar.Map).Init(),
+		bytesSent:           new(expvar.Map).Init(),
+		bytesReceived:       new(expvar.Map).Init(),
+		callSeconds:         new(expvar.Map).Init(),
+		callErrors:          new(expvar.Map).Init(),
+		pendingCalls:        new(expvar.Int),
+		droppedSignals:      new(expvar.Int),
+		droppedEavesdropped: new(expvar.Int),
+		handlerSeconds:      new(expvar.Map).Init(),
+		handlerErrors:       new(expvar.Map).Init(),
+		handlerPanics:       new(expvar.Map).Init(),
+	}
+	m.vars.Set("messages_sent", m.messagesSent)
+	m.vars.Set("messages_received", m.messagesReceived)
+	m.vars.Set("bytes_sent", m.bytesSent)
+	m.vars.Set("bytes_received", m.bytesReceived)
+	m.vars.Set("call_seconds", m.callSeconds)
+	m.vars.Set("call_errors", m.callErrors)
+	m.vars.Set("pending_calls", m.pendingCalls)
+	m.vars.Set("dropped_signals", m.droppedSignals)
+	m.vars.Set("dropped_eavesdropped_messages", m.droppedEavesdropped)
+	m.vars.Set("handler_seconds", m.handlerSeconds)
+	m.vars.Set("handler_errors", m.handlerErrors)
+	m.vars.Set("handler_panics", m.handlerPanics)
+	return m
+}
+
+// Map returns the map that holds all metrics.
+func (m *Metrics) Map() *expvar.Map {
+	return m.vars
+}
+
+// MessageSent implements dbus.Metrics.
+func (m *Metrics) MessageSent(typ dbus.Type, size int) {
+	m.messagesSent.Add(typ.String(), 1)
+	m.bytesSent.Add(typ.String(), int64(size))
+}
+
+// MessageReceived implements dbus.Metrics.
+func (m *Metrics) MessageReceived(typ dbus.Type, size int) {
+	m.messagesReceived.Add(typ.String(), 1)
+	m.bytesReceived.Add(typ.String(), int64(size))
+}
+
+// CallCompleted implements dbus.Metrics.
+func (m *Metrics) CallCompleted(iface, member string, d time.Duration, err error) {
+	name := iface + "." + member
+	m.histogram(m.callSeconds, name).Observe(d)
+	if err != nil {
+		m.callErrors.Add(name, 1)
+	}
+}
+
+// PendingCalls implements dbus.Metrics. If the Metrics are shared by multiple
+// connections, the number is the one of the connection that reported last.
+func (m *Metrics) PendingCalls(n int) {
+	m.pendingCalls.Set(int64(n))
+}
+
+// SignalDropped implements dbus.Metrics.
+func (m *Metrics) SignalDropped() {
+	m.droppedSignals.Add(1)
+}
+
+// EavesdropDropped implements dbus.Metrics.
+func (m *Metrics) EavesdropDropped() {
+	m.droppedEavesdropped.Add(1)
+}
+
+// HandlerCompleted implements dbus.Metrics.
+func (m *Metrics) HandlerCompleted(iface, member string, d time.Duration, err error) {
+	name := iface + "." + member
+	m.histogram(m.handlerSeconds, name).Observe(d)
+	if err != nil {
+		m.handlerErrors.Add(name, 1)
+	}
+}
+
+// HandlerPanicked implements dbus.Metrics.
+func (m *Metrics) HandlerPanicked(iface, member string, v interface{}) {
+	m.handlerPanics.Add(iface+"."+member, 1)
+}
+
+// histogram returns the histogram for key in vars, creating it if necessary.
+func (m *Metrics) histogram(vars *expvar.Map, key string) *Histogram {
+	if h, ok := vars.Get(key).(*Histogram); ok {
+		return h
+	}
+	m.histogramLck.Lock()
+	defer m.histogramLck.Unlock()
+	if h, ok := vars.Get(key).(*Histogram); ok {
+		return h
+	}
+	h := NewHistogram(DefaultBuckets)
+	vars.Set(key, h)
+	return h
+}
+
+// Histogram is an expvar.Var that counts durations in buckets. Its JSON
+// representation contains the number of durations, their sum in seconds and
+// the cumulative counts of the buckets by their upper bound, e.g.
+//
+//	{"count": 3, "sum": 0.0042, "buckets": {"0.001": 1, "0.005": 3, "+Inf": 3}}
+type Histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // one more than bounds, for +Inf
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a histogram with buckets with the given upper bounds
+// in seconds, which must be sorted.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// Observe adds d to the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	s := d.Seconds()
+	i := sort.SearchFloat64s(h.bounds, s)
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += s
+	h.mu.Unlock()
+}
+
+// String implements expvar.Var.
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, `{"count": %d, "sum": %s, "buckets": {`, h.count, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	var n uint64
+	for i, bound := range h.bounds {
+		n += h.counts[i]
+		fmt.Fprintf(&b, `"%s": %d, `, strconv.FormatFloat(bound, 'g', -1, 64), n)
+	}
+	fmt.Fprintf(&b, `"+Inf": %d}}`, h.count)
+	return b.String()
+}
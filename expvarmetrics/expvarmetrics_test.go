@@ -0,0 +1,73 @@
+package expvarmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.001, 0.01})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(5 * time.Millisecond)
+	h.Observe(time.Second)
+
+	var v struct {
+		Count   uint64
+		Sum     float64
+		Buckets map[string]uint64
+	}
+	if err := json.Unmarshal([]byte(h.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Count != 3 || v.Sum != 1.0055 {
+		t.Errorf("got count %d and sum %v", v.Count, v.Sum)
+	}
+	if v.Buckets["0.001"] != 1 || v.Buckets["0.01"] != 2 || v.Buckets["+Inf"] != 3 {
+		t.Errorf("got buckets %v", v.Buckets)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := New("dbus_test")
+	var _ dbus.Metrics = m
+	m.MessageSent(dbus.TypeMethodCall, 100)
+	m.MessageSent(dbus.TypeMethodCall, 50)
+	m.MessageReceived(dbus.TypeSignal, 80)
+	m.CallCompleted("org.example.Iface", "Get", time.Millisecond, nil)
+	m.CallCompleted("org.example.Iface", "Get", time.Millisecond, errors.New("failed"))
+	m.PendingCalls(3)
+	m.SignalDropped()
+	m.HandlerCompleted("org.example.Iface", "Set", time.Millisecond, nil)
+	m.HandlerPanicked("org.example.Iface", "Set", "oops")
+
+	var v struct {
+		MessagesSent   map[string]int64                 `json:"messages_sent"`
+		BytesSent      map[string]int64                 `json:"bytes_sent"`
+		BytesReceived  map[string]int64                 `json:"bytes_received"`
+		CallSeconds    map[string]struct{ Count int64 } `json:"call_seconds"`
+		CallErrors     map[string]int64                 `json:"call_errors"`
+		PendingCalls   int64                            `json:"pending_calls"`
+		DroppedSignals int64                            `json:"dropped_signals"`
+		HandlerSeconds map[string]struct{ Count int64 } `json:"handler_seconds"`
+		HandlerPanics  map[string]int64                 `json:"handler_panics"`
+	}
+	if err := json.Unmarshal([]byte(m.Map().String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.MessagesSent["method call"] != 2 || v.BytesSent["method call"] != 150 || v.BytesReceived["signal"] != 80 {
+		t.Errorf("got messages %v, bytes %v and %v", v.MessagesSent, v.BytesSent, v.BytesReceived)
+	}
+	if v.CallSeconds["org.example.Iface.Get"].Count != 2 || v.CallErrors["org.example.Iface.Get"] != 1 {
+		t.Errorf("got calls %v and errors %v", v.CallSeconds, v.CallErrors)
+	}
+	if v.PendingCalls != 3 || v.DroppedSignals != 1 {
+		t.Errorf("got %d pending calls and %d dropped signals", v.PendingCalls, v.DroppedSignals)
+	}
+	if v.HandlerSeconds["org.example.Iface.Set"].Count != 1 || v.HandlerPanics["org.example.Iface.Set"] != 1 {
+		t.Errorf("got handlers %v and panics %v", v.HandlerSeconds, v.HandlerPanics)
+	}
+}
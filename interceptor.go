@@ -0,0 +1,178 @@
+package dbus
+
+import (
+	"context"
+	"sync"
+)
+
+// CallHandler handles a method call and returns the body of its reply or an
+// error.
+type CallHandler func(ctx context.Context, msg *Message) ([]interface{}, error)
+
+// Interceptor intercepts method calls, e.g. to log them, to collect metrics,
+// to check whether the caller is authorized or to retry failed calls. It is
+// passed the call and the next handler in the chain, which sends the call or
+// calls the exported method in the end. The interceptor may change the call
+// before passing it on, change the outcome, call next multiple times or not
+// at all, in which case it decides the outcome itself.
+//
+// The outcome is the body of the reply or an error, which is an Error if the
+// peer replied with an error. Calls with FlagNoReplyExpected set have an
+// empty outcome unless they couldn't be sent.
+type Interceptor func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error)
+
+// SetClientInterceptors sets the interceptors for the method calls sent on
+// conn with Call, Go, Send and the other methods that send calls, including
+// the ones to the bus. They replace the interceptors set before; the first
+// one is called first. Passing no interceptors removes them.
+//
+// The calls that are passed to the interceptors have no serial yet; each call
+// of the last handler in the chain sends the call with a new one. If an
+// interceptor changes the body of the call, the signature is changed
+// accordingly. Calls without FlagNoReplyExpected are passed through the
+// interceptors in a new goroutine, but Go and Send only return once the call
+// was sent for the first time or the interceptors returned, so calls that are
+// made one after another are sent in order.
+func (conn *Conn) SetClientInterceptors(interceptors ...Interceptor) {
+	conn.interceptorLck.Lock()
+	conn.clientInterceptors = interceptors
+	conn.interceptorLck.Unlock()
+}
+
+// SetServerInterceptors sets the interceptors for the method calls received
+// on conn, including the ones that fail because there is no matching exported
+// method. They replace the interceptors set before; the first one is called
+// first. Passing no interceptors removes them. The reply is sent once the
+// interceptors returned, with the outcome of the first interceptor.
+//
+// The context passed to the interceptors is the one that is passed to the
+// exported method. If the method uses a DeferredReply, the last handler in
+// the chain waits until it is replied to or the context is done, e.g. because
+// the timeout set with SetHandlerTimeout expired. If the DeferredReply is
+// garbage collected without being used, the outcome is a NoReply error.
+func (conn *Conn) SetServerInterceptors(interceptors ...Interceptor) {
+	conn.interceptorLck.Lock()
+	conn.serverInterceptors = interceptors
+	conn.interceptorLck.Unlock()
+}
+
+func (conn *Conn) getClientInterceptors() []Interceptor {
+	conn.interceptorLck.RLock()
+	defer conn.interceptorLck.RUnlock()
+	return conn.clientInterceptors
+}
+
+func (conn *Conn) getServerInterceptors() []Interceptor {
+	conn.interceptorLck.RLock()
+	defer conn.interceptorLck.RUnlock()
+	return conn.serverInterceptors
+}
+
+// chainInterceptors returns a handler that calls the interceptors in order,
+// with handler as the last one.
+func chainInterceptors(interceptors []Interceptor, handler CallHandler) CallHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, msg *Message) ([]interface{}, error) {
+			return interceptor(ctx, msg, next)
+		}
+	}
+	return handler
+}
+
+// interceptCall sends the method call msg through the client interceptors.
+// The returned Call behaves like one for a call that is sent directly.
+func (conn *Conn) interceptCall(ctx context.Context, msg *Message, ch chan *Call, interceptors []Interceptor) *Call {
+	if msg.Flags&FlagNoReplyExpected != 0 {
+		_, err := chainInterceptors(interceptors, conn.invoke)(ctx, msg)
+		done := make(chan *Call, 1)
+		call := &Call{Err: err, Done: done}
+		done <- call
+		close(done)
+		return call
+	}
+	if ch == nil {
+		ch = make(chan *Call, 10)
+	} else if cap(ch) == 0 {
+		panic("dbus: unbuffered channel passed to (*Object).Go or (*Conn).Send")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	iface, _ := msg.Headers[FieldInterface].value.(string)
+	member, _ := msg.Headers[FieldMember].value.(string)
+	call := &Call{
+		Method:      iface + "." + member,
+		Args:        msg.Body,
+		Done:        ch,
+		ctx:         ctx,
+		ctxCanceler: cancel,
+	}
+	call.Destination, _ = msg.Headers[FieldDestination].value.(string)
+	call.Path, _ = msg.Headers[FieldPath].value.(ObjectPath)
+
+	var once sync.Once
+	sent, finished := make(chan struct{}), make(chan struct{})
+	invoke := chainInterceptors(interceptors, func(ctx context.Context, msg *Message) ([]interface{}, error) {
+		return conn.invokeAndNotify(ctx, msg, func() {
+			once.Do(func() { close(sent) })
+		})
+	})
+	go func() {
+		call.Body, call.Err = invoke(ctx, msg)
+		close(finished)
+		call.done()
+	}()
+	select {
+	case <-sent:
+	case <-finished:
+	}
+	return call
+}
+
+// invoke is the last client handler. It sends a copy of msg with a new serial
+// and waits for the reply.
+func (conn *Conn) invoke(ctx context.Context, msg *Message) ([]interface{}, error) {
+	return conn.invokeAndNotify(ctx, msg, nil)
+}
+
+// invokeAndNotify is like invoke, but calls notify once msg was sent, if it
+// is not nil.
+func (conn *Conn) invokeAndNotify(ctx context.Context, msg *Message, notify func()) ([]interface{}, error) {
+	sent := *msg
+	sent.serial = conn.getSerial()
+	sent.Headers = make(map[HeaderField]Variant, len(msg.Headers))
+	for k, v := range msg.Headers {
+		sent.Headers[k] = v
+	}
+	delete(sent.Headers, FieldSignature)
+	if len(sent.Body) > 0 {
+		sent.Headers[FieldSignature] = MakeVariant(SignatureOf(sent.Body...))
+	}
+
+	if sent.Flags&FlagNoReplyExpected != 0 {
+		var err error
+		conn.sendMessageAndIfClosed(&sent, func(e error) {
+			err = e
+		})
+		if notify != nil {
+			notify()
+		}
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	call := &Call{Done: make(chan *Call, 1), ctx: ctx, ctxCanceler: cancel}
+	conn.observeCall(call, &sent)
+	conn.calls.track(sent.serial, call)
+	go func() {
+		<-ctx.Done()
+		conn.calls.handleSendError(&sent, ctx.Err())
+	}()
+	conn.sendMessageAndIfClosed(&sent, func(err error) {
+		conn.calls.handleSendError(&sent, err)
+		cancel()
+	})
+	if notify != nil {
+		notify()
+	}
+	<-call.Done
+	return call.Body, call.Err
+}
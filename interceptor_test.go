@@ -0,0 +1,208 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientInterceptors(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	if err := server.Export(barExport{}, "/org/guelfey/DBus/Interceptor", "org.guelfey.DBus.Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var log []string
+	logger := func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error) {
+		member, _ := msg.Headers[FieldMember].value.(string)
+		body, err := next(ctx, msg)
+		mu.Lock()
+		log = append(log, member)
+		mu.Unlock()
+		return body, err
+	}
+	cache := func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error) {
+		if msg.Headers[FieldMember].value == "Cached" {
+			return []interface{}{"cached"}, nil
+		}
+		return next(ctx, msg)
+	}
+	retries := 0
+	retry := func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error) {
+		body, err := next(ctx, msg)
+		if err != nil && retries == 0 {
+			retries++
+			// fix the argument and try again
+			msg.Headers[FieldMember] = MakeVariant("Foo")
+			body, err = next(ctx, msg)
+		}
+		return body, err
+	}
+	client.SetClientInterceptors(logger, cache, retry)
+
+	obj := client.Object(server.Names()[0], "/org/guelfey/DBus/Interceptor")
+	var s string
+	if err := obj.Call("org.guelfey.DBus.Test.Cached", 0).Store(&s); err != nil || s != "cached" {
+		t.Errorf("Cached: got %q, %v", s, err)
+	}
+	if err := obj.Call("org.guelfey.DBus.Test.Foo", 0, "a").Store(&s); err != nil || s != "bar" {
+		t.Errorf("Foo: got %q, %v", s, err)
+	}
+	call := <-obj.Go("org.guelfey.DBus.Test.Missing", 0, nil, "a").Done
+	if err := call.Store(&s); err != nil || s != "bar" || retries != 1 {
+		t.Errorf("retried call: got %q, %v after %d retries", s, err, retries)
+	}
+	if err := obj.Call("org.guelfey.DBus.Test.Foo", FlagNoReplyExpected, "a").Err; err != nil {
+		t.Error(err)
+	}
+
+	// calls made one after another are sent in order
+	var args []string
+	client.SetCapture(func(msg *Message, sent bool) {
+		if sent && msg.Type == TypeMethodCall && len(msg.Body) == 1 {
+			args = append(args, msg.Body[0].(string))
+		}
+	})
+	var calls []*Call
+	var expected []string
+	for i := 0; i < 10; i++ {
+		arg := strconv.Itoa(i)
+		calls = append(calls, obj.Go("org.guelfey.DBus.Test.Foo", 0, nil, arg))
+		expected = append(expected, arg)
+	}
+	for _, call := range calls {
+		<-call.Done
+	}
+	client.SetCapture(nil)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("calls were sent in the order %v", args)
+	}
+
+	client.SetClientInterceptors()
+	if err := obj.Call("org.guelfey.DBus.Test.Foo", 0, "a").Err; err != nil {
+		t.Error(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected = []string{"Cached", "Foo", "Missing", "Foo"}
+	for range calls {
+		expected = append(expected, "Foo")
+	}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("got log %v, expected %v", log, expected)
+	}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	export := deferredExport{make(chan error, 1)}
+	if err := server.Export(export, "/org/guelfey/DBus/Interceptor", "org.guelfey.DBus.Test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Export(barExport{}, "/org/guelfey/DBus/Interceptor", "org.guelfey.DBus.Bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	type outcome struct {
+		member string
+		body   []interface{}
+		err    error
+	}
+	outcomes := make(chan outcome, 10)
+	recorder := func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error) {
+		member, _ := msg.Headers[FieldMember].value.(string)
+		body, err := next(ctx, msg)
+		outcomes <- outcome{member, body, err}
+		return body, err
+	}
+	errDenied := errors.New("denied")
+	auth := func(ctx context.Context, msg *Message, next CallHandler) ([]interface{}, error) {
+		if sender, _ := SenderFromContext(ctx); sender != Sender(client.Names()[0]) {
+			t.Errorf("got sender %q", sender)
+		}
+		if msg.Headers[FieldMember].value == "Forbidden" {
+			return nil, errDenied
+		}
+		return next(ctx, msg)
+	}
+	server.SetServerInterceptors(recorder, auth)
+
+	obj := client.Object(server.Names()[0], "/org/guelfey/DBus/Interceptor")
+	var s string
+	if err := obj.Call("org.guelfey.DBus.Bar.Foo", 0, "a").Store(&s); err != nil || s != "bar" {
+		t.Errorf("Foo: got %q, %v", s, err)
+	}
+	if o := <-outcomes; o.member != "Foo" || !reflect.DeepEqual(o.body, []interface{}{"bar"}) || o.err != nil {
+		t.Errorf("Foo: got outcome %+v", o)
+	}
+
+	err := obj.Call("org.guelfey.DBus.Bar.Forbidden", 0).Err
+	if dbusErr, ok := err.(Error); !ok || dbusErr.Name != "org.freedesktop.DBus.Error.Failed" {
+		t.Errorf("Forbidden: got %v", err)
+	}
+	if o := <-outcomes; o.err != errDenied {
+		t.Errorf("Forbidden: got outcome %+v", o)
+	}
+
+	if err := obj.Call("org.guelfey.DBus.Bar.Missing", 0).Err; err == nil {
+		t.Error("Missing: call succeeded")
+	}
+	if o := <-outcomes; o.err == nil || o.err.(Error).Name != ErrMsgUnknownMethod.Name {
+		t.Errorf("Missing: got outcome %+v", o)
+	}
+
+	// deferred replies are seen once they are sent
+	var n int64
+	if err := obj.Call("org.guelfey.DBus.Test.Later", 0, int64(21)).Store(&n); err != nil || n != 42 {
+		t.Errorf("Later: got %d, %v", n, err)
+	}
+	if o := <-outcomes; !reflect.DeepEqual(o.body, []interface{}{int64(42)}) || o.err != nil {
+		t.Errorf("Later: got outcome %+v", o)
+	}
+	if err := <-export.second; err != ErrAlreadyReplied {
+		t.Errorf("second reply: got %v", err)
+	}
+	if err := obj.Call("org.guelfey.DBus.Test.Fail", 0).Err; err == nil {
+		t.Error("Fail: call succeeded")
+	}
+	if o := <-outcomes; o.err == nil {
+		t.Errorf("Fail: got outcome %+v", o)
+	}
+
+	call := obj.Go("org.guelfey.DBus.Test.Never", 0, nil)
+	for i := 0; call.Err == nil && i < 100; i++ {
+		runtime.GC()
+		select {
+		case call = <-call.Done:
+			if o := <-outcomes; o.err == nil || o.err.(Error).Name != errMsgNoReply.Name {
+				t.Errorf("Never: got outcome %+v", o)
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if e, ok := call.Err.(Error); !ok || e.Name != errMsgNoReply.Name {
+		t.Errorf("Never: got %v, expected a NoReply error", call.Err)
+	}
+
+	server.SetHandlerTimeout(50 * time.Millisecond)
+	if err := obj.Call("org.guelfey.DBus.Test.Slow", 0).Err; err == nil {
+		t.Error("Slow: call succeeded")
+	}
+	if o := <-outcomes; o.err != context.DeadlineExceeded {
+		t.Errorf("Slow: got outcome %+v", o)
+	}
+}
@@ -0,0 +1,195 @@
+package introspect
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// Names of the standard annotations.
+const (
+	DeprecatedAnnotation = "org.freedesktop.DBus.Deprecated"
+	NoReplyAnnotation    = "org.freedesktop.DBus.Method.NoReply"
+)
+
+// InterfaceDescription holds the parts of an interface that can't be derived
+// from the Go type that implements it.
+type InterfaceDescription struct {
+	// Methods describes the methods of the interface by their D-Bus name.
+	// Methods that aren't described get unnamed arguments.
+	Methods map[string]MethodDescription
+
+	// Mapping maps Go method names to D-Bus method names, like the mapping
+	// passed to dbus.Conn.ExportWithMap.
+	Mapping map[string]string
+
+	// Signals maps the names of the signals of the interface to a struct (or
+	// a pointer to one) whose exported fields are the arguments of the
+	// signal. The argument names are taken from the dbus struct tag, e.g.
+	// `dbus:"object_path"`, or else from the field name. Fields tagged with
+	// `dbus:"-"` are skipped.
+	Signals map[string]interface{}
+
+	// Properties are the properties of the interface, e.g. the result of
+	// prop.Properties.Introspection.
+	Properties []Property
+
+	// Deprecated marks the whole interface as deprecated.
+	Deprecated bool
+}
+
+// MethodDescription holds the parts of a method that can't be derived from
+// its Go type.
+type MethodDescription struct {
+	// In and Out are the names of the input and output arguments. If they
+	// are set, they must have as many elements as the method has
+	// arguments.
+	In, Out []string
+
+	// NoReply marks methods whose callers don't expect a reply.
+	NoReply bool
+
+	// Deprecated marks the method as deprecated.
+	Deprecated bool
+}
+
+// NewInterface returns the description of the interface name, as it is
+// exported by passing v to dbus.Conn.Export (or ExportWithMap, if
+// desc.Mapping is set). desc may be nil. NewNode describes all interfaces of
+// an object.
+//
+// An error is returned if desc doesn't match v, e.g. if it describes a method
+// that v doesn't have, so that published introspection data can't silently
+// go out of sync with the code.
+func NewInterface(name string, v interface{}, desc *InterfaceDescription) (Interface, error) {
+	if desc == nil {
+		desc = &InterfaceDescription{}
+	}
+	iface := Interface{Name: name, Properties: desc.Properties}
+	if desc.Deprecated {
+		iface.Annotations = append(iface.Annotations, Annotation{DeprecatedAnnotation, "true"})
+	}
+
+	described := make(map[string]bool)
+	for _, m := range Methods(v) {
+		if mapped, ok := desc.Mapping[m.Name]; ok {
+			m.Name = mapped
+		}
+		md, ok := desc.Methods[m.Name]
+		if ok {
+			described[m.Name] = true
+			if err := nameArgs(m.Args, "in", md.In); err != nil {
+				return Interface{}, errors.New("method " + m.Name + ": " + err.Error())
+			}
+			if err := nameArgs(m.Args, "out", md.Out); err != nil {
+				return Interface{}, errors.New("method " + m.Name + ": " + err.Error())
+			}
+			if md.NoReply {
+				m.Annotations = append(m.Annotations, Annotation{NoReplyAnnotation, "true"})
+			}
+			if md.Deprecated {
+				m.Annotations = append(m.Annotations, Annotation{DeprecatedAnnotation, "true"})
+			}
+		}
+		iface.Methods = append(iface.Methods, m)
+	}
+	for name := range desc.Methods {
+		if !described[name] {
+			return Interface{}, errors.New("method " + name + " is described but not implemented")
+		}
+	}
+
+	names := make([]string, 0, len(desc.Signals))
+	for name := range desc.Signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args, err := signalArgs(desc.Signals[name])
+		if err != nil {
+			return Interface{}, errors.New("signal " + name + ": " + err.Error())
+		}
+		iface.Signals = append(iface.Signals, Signal{Name: name, Args: args})
+	}
+	return iface, nil
+}
+
+// NewNode returns the introspection data of an object that exports the values
+// of ifaces as the interfaces given by their keys. The interfaces are
+// described by NewInterface with the descriptions in descs, which may be nil
+// or lack some of them, and sorted by name. The result can be passed to
+// NewIntrospectable or encoded with encoding/xml.
+//
+// An error is returned if NewInterface fails for an interface or if descs
+// describes an interface that isn't in ifaces.
+func NewNode(ifaces map[string]interface{}, descs map[string]*InterfaceDescription) (*Node, error) {
+	for name := range descs {
+		if _, ok := ifaces[name]; !ok {
+			return nil, errors.New("interface " + name + " is described but not implemented")
+		}
+	}
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	node := &Node{}
+	for _, name := range names {
+		iface, err := NewInterface(name, ifaces[name], descs[name])
+		if err != nil {
+			return nil, errors.New("interface " + name + ": " + err.Error())
+		}
+		node.Interfaces = append(node.Interfaces, iface)
+	}
+	return node, nil
+}
+
+// nameArgs sets the names of the arguments with the given direction.
+func nameArgs(args []Arg, direction string, names []string) error {
+	if names == nil {
+		return nil
+	}
+	n := 0
+	for i := range args {
+		if args[i].Direction != direction {
+			continue
+		}
+		if n < len(names) {
+			args[i].Name = names[n]
+		}
+		n++
+	}
+	if n != len(names) {
+		return errors.New("wrong number of " + direction + " argument names")
+	}
+	return nil
+}
+
+// signalArgs returns the arguments for the fields of the struct v.
+func signalArgs(v interface{}) ([]Arg, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("arguments are not described by a struct")
+	}
+	var args []Arg
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("dbus"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		args = append(args, Arg{Name: name, Type: dbus.SignatureOfType(field.Type).String()})
+	}
+	return args, nil
+}
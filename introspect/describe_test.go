@@ -0,0 +1,96 @@
+package introspect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+type battery struct{}
+
+func (battery) Charge(sender dbus.Sender, level byte) (bool, *dbus.Error) { return true, nil }
+
+func (battery) Reset() *dbus.Error { return nil }
+
+type batteryChanged struct {
+	Level   byte   `dbus:"level"`
+	Name    string // no tag
+	Ignored int    `dbus:"-"`
+	private int
+}
+
+func TestNewInterface(t *testing.T) {
+	iface, err := NewInterface("org.example.Battery", battery{}, &InterfaceDescription{
+		Methods: map[string]MethodDescription{
+			"Charge": {In: []string{"level"}, Out: []string{"ok"}, Deprecated: true},
+			"reset":  {NoReply: true},
+		},
+		Mapping:    map[string]string{"Reset": "reset"},
+		Signals:    map[string]interface{}{"Changed": &batteryChanged{}},
+		Properties: []Property{{Name: "Level", Type: "y", Access: "read"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Interface{
+		Name: "org.example.Battery",
+		Methods: []Method{
+			{
+				Name:        "Charge",
+				Args:        []Arg{{"level", "y", "in"}, {"ok", "b", "out"}},
+				Annotations: []Annotation{{DeprecatedAnnotation, "true"}},
+			},
+			{
+				Name:        "reset",
+				Args:        []Arg{},
+				Annotations: []Annotation{{NoReplyAnnotation, "true"}},
+			},
+		},
+		Signals: []Signal{
+			{Name: "Changed", Args: []Arg{{Name: "level", Type: "y"}, {Name: "Name", Type: "s"}}},
+		},
+		Properties: []Property{{Name: "Level", Type: "y", Access: "read"}},
+	}
+	if !reflect.DeepEqual(iface, expected) {
+		t.Errorf("unexpected interface\n%#v\nexpected\n%#v", iface, expected)
+	}
+}
+
+func TestNewInterfaceMismatch(t *testing.T) {
+	descs := []*InterfaceDescription{
+		{Methods: map[string]MethodDescription{"Missing": {}}},
+		{Methods: map[string]MethodDescription{"Charge": {In: []string{"level", "extra"}}}},
+		{Signals: map[string]interface{}{"Changed": 1}},
+	}
+	for _, desc := range descs {
+		if _, err := NewInterface("org.example.Battery", battery{}, desc); err == nil {
+			t.Errorf("no error for %v", desc)
+		}
+	}
+}
+
+func TestNewNode(t *testing.T) {
+	node, err := NewNode(map[string]interface{}{
+		"org.example.Battery": battery{},
+		"org.example.Empty":   struct{}{},
+	}, map[string]*InterfaceDescription{
+		"org.example.Battery": {Methods: map[string]MethodDescription{"Charge": {In: []string{"level"}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Interfaces) != 2 || node.Interfaces[0].Name != "org.example.Battery" ||
+		node.Interfaces[1].Name != "org.example.Empty" {
+		t.Fatalf("unexpected node %#v", node)
+	}
+	if arg := node.Interfaces[0].Methods[0].Args[0]; arg.Name != "level" {
+		t.Errorf("unexpected argument %#v", arg)
+	}
+
+	_, err = NewNode(map[string]interface{}{"org.example.Battery": battery{}},
+		map[string]*InterfaceDescription{"org.example.Missing": {}})
+	if err == nil {
+		t.Error("no error for a missing interface")
+	}
+}
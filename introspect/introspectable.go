@@ -1,6 +1,7 @@
 package introspect
 
 import (
+	"context"
 	"encoding/xml"
 	"github.com/godbus/dbus"
 	"reflect"
@@ -57,20 +58,30 @@ func Methods(v interface{}) []Method {
 		}
 		var m Method
 		m.Name = t.Method(i).Name
-		m.Args = make([]Arg, 0, mt.NumIn()+mt.NumOut()-2)
-		for j := 1; j < mt.NumIn(); j++ {
-			if mt.In(j) != reflect.TypeOf((*dbus.Sender)(nil)).Elem() &&
-				mt.In(j) != reflect.TypeOf((*dbus.Message)(nil)).Elem() {
-				arg := Arg{"", dbus.SignatureOfType(mt.In(j)).String(), "in"}
-				m.Args = append(m.Args, arg)
-			}
-		}
-		for j := 0; j < mt.NumOut()-1; j++ {
-			arg := Arg{"", dbus.SignatureOfType(mt.Out(j)).String(), "out"}
-			m.Args = append(m.Args, arg)
-		}
+		m.Args = methodArgs(mt)
 		m.Annotations = make([]Annotation, 0)
 		ms = append(ms, m)
 	}
 	return ms
 }
+
+// methodArgs returns the arguments of the method type mt, whose first
+// parameter is the receiver. The parameters that are filled in by Export are
+// skipped.
+func methodArgs(mt reflect.Type) []Arg {
+	args := make([]Arg, 0, mt.NumIn()+mt.NumOut()-2)
+	for j := 1; j < mt.NumIn(); j++ {
+		if mt.In(j) != reflect.TypeOf((*dbus.Sender)(nil)).Elem() &&
+			mt.In(j) != reflect.TypeOf((*dbus.Message)(nil)).Elem() &&
+			mt.In(j) != reflect.TypeOf((*context.Context)(nil)).Elem() &&
+			mt.In(j) != reflect.TypeOf((*dbus.DeferredReply)(nil)) {
+			arg := Arg{"", dbus.SignatureOfType(mt.In(j)).String(), "in"}
+			args = append(args, arg)
+		}
+	}
+	for j := 0; j < mt.NumOut()-1; j++ {
+		arg := Arg{"", dbus.SignatureOfType(mt.Out(j)).String(), "out"}
+		args = append(args, arg)
+	}
+	return args
+}
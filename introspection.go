@@ -0,0 +1,143 @@
+package dbus
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+)
+
+// Introspector may be implemented by values passed to Export to add elements
+// that can't be derived from their methods, like signals or properties, to the
+// introspection data generated for the object they are exported on.
+type Introspector interface {
+	// IntrospectInterface returns additional XML elements (e.g. <signal> or
+	// <property>) for the interface iface of the object. It is called for
+	// every interface of the object, not only the one the value is exported
+	// as.
+	IntrospectInterface(iface string) string
+}
+
+const introspectableXML = `
+	<interface name="org.freedesktop.DBus.Introspectable">
+		<method name="Introspect">
+			<arg name="out" type="s" direction="out"/>
+		</method>
+	</interface>`
+
+const peerXML = `
+	<interface name="org.freedesktop.DBus.Peer">
+		<method name="Ping"/>
+		<method name="GetMachineId">
+			<arg name="machine_uuid" type="s" direction="out"/>
+		</method>
+	</interface>`
+
+var (
+	senderType        = reflect.TypeOf((*Sender)(nil)).Elem()
+	messageType       = reflect.TypeOf((*Message)(nil)).Elem()
+	contextType       = reflect.TypeOf((*context.Context)(nil)).Elem()
+	deferredReplyType = reflect.TypeOf((*DeferredReply)(nil))
+)
+
+// writeInterfaces writes the introspection data of the given interfaces and
+// of the interfaces that are implemented for every object.
+func writeInterfaces(xml *bytes.Buffer, interfaces map[string]*exportedIntf) {
+	names := make([]string, 0, len(interfaces))
+	var introspectors []Introspector
+	for name, intf := range interfaces {
+		if name != "org.freedesktop.DBus.Introspectable" && name != "org.freedesktop.DBus.Peer" {
+			names = append(names, name)
+		}
+		if i, ok := intf.value.(Introspector); ok && !containsIntrospector(introspectors, i) {
+			introspectors = append(introspectors, i)
+		}
+	}
+	// interfaces that only have properties
+	if intf, ok := interfaces[propertiesIface]; ok {
+		if p, ok := intf.value.(PropertyProvider); ok {
+			for _, name := range p.Interfaces() {
+				if _, exists := interfaces[name]; !exists {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		xml.WriteString("\n\t<interface name=\"" + name + "\">")
+		if intf, ok := interfaces[name]; ok {
+			writeMethods(xml, intf.methods)
+		}
+		for _, i := range introspectors {
+			if s := i.IntrospectInterface(name); s != "" {
+				xml.WriteString("\n\t\t" + s)
+			}
+		}
+		xml.WriteString("\n\t</interface>")
+	}
+	xml.WriteString(introspectableXML)
+	xml.WriteString(peerXML)
+}
+
+func containsIntrospector(introspectors []Introspector, i Introspector) bool {
+	if !reflect.TypeOf(i).Comparable() {
+		return false
+	}
+	for _, v := range introspectors {
+		if reflect.TypeOf(v) == reflect.TypeOf(i) && v == i {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMethods writes the <method> elements for the given methods. Methods
+// with arguments that can't be represented on the bus are left out.
+func writeMethods(xml *bytes.Buffer, methods map[string]Method) {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m, ok := methods[name].(exportedMethod)
+		if !ok {
+			continue
+		}
+		args, ok := methodArgs(m.Type())
+		if !ok {
+			continue
+		}
+		if len(args) == 0 {
+			xml.WriteString("\n\t\t<method name=\"" + name + "\"/>")
+			continue
+		}
+		xml.WriteString("\n\t\t<method name=\"" + name + "\">")
+		for _, arg := range args {
+			xml.WriteString("\n\t\t\t" + arg)
+		}
+		xml.WriteString("\n\t\t</method>")
+	}
+}
+
+// methodArgs returns the <arg> elements for the function type t. Parameters
+// that are filled in by Export and the trailing *Error are skipped.
+func methodArgs(t reflect.Type) (args []string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			args, ok = nil, false
+		}
+	}()
+	for i := 0; i < t.NumIn(); i++ {
+		switch t.In(i) {
+		case senderType, messageType, contextType, deferredReplyType:
+			continue
+		}
+		args = append(args, `<arg type="`+string(getSignature(t.In(i)))+`" direction="in"/>`)
+	}
+	for i := 0; i < t.NumOut()-1; i++ {
+		args = append(args, `<arg type="`+string(getSignature(t.Out(i)))+`" direction="out"/>`)
+	}
+	return args, true
+}
@@ -0,0 +1,145 @@
+package dbus
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MatchOption specifies an element of a match rule, as used by
+// AddMatchSignal and RemoveMatchSignal.
+type MatchOption struct {
+	key   string
+	value string
+}
+
+// WithMatchOption creates an option with an arbitrary key and value.
+func WithMatchOption(key, value string) MatchOption {
+	return MatchOption{key, value}
+}
+
+// WithMatchType matches messages of the given type.
+func WithMatchType(t Type) MatchOption {
+	var s string
+	switch t {
+	case TypeMethodCall:
+		s = "method_call"
+	case TypeMethodReply:
+		s = "method_return"
+	case TypeError:
+		s = "error"
+	case TypeSignal:
+		s = "signal"
+	}
+	return WithMatchOption("type", s)
+}
+
+// WithMatchSender matches messages sent by the given unique or well-known
+// name.
+func WithMatchSender(sender string) MatchOption {
+	return WithMatchOption("sender", sender)
+}
+
+// WithMatchObjectPath matches messages sent from or to the given object.
+func WithMatchObjectPath(path ObjectPath) MatchOption {
+	return WithMatchOption("path", string(path))
+}
+
+// WithMatchPathNamespace matches messages sent from or to the given object or
+// one of its descendants.
+func WithMatchPathNamespace(namespace ObjectPath) MatchOption {
+	return WithMatchOption("path_namespace", string(namespace))
+}
+
+// WithMatchInterface matches messages with the given interface.
+func WithMatchInterface(iface string) MatchOption {
+	return WithMatchOption("interface", iface)
+}
+
+// WithMatchMember matches messages with the given member.
+func WithMatchMember(member string) MatchOption {
+	return WithMatchOption("member", member)
+}
+
+// WithMatchDestination matches messages sent to the given unique name.
+func WithMatchDestination(destination string) MatchOption {
+	return WithMatchOption("destination", destination)
+}
+
+// WithMatchArg matches messages whose argument with the given index (starting
+// at 0) is the given string.
+func WithMatchArg(index int, value string) MatchOption {
+	return WithMatchOption("arg"+strconv.Itoa(index), value)
+}
+
+// WithMatchArgPath matches messages whose argument with the given index is a
+// string or object path that is equal to path, or where one of them ends with
+// a slash and is a prefix of the other.
+func WithMatchArgPath(index int, path string) MatchOption {
+	return WithMatchOption("arg"+strconv.Itoa(index)+"path", path)
+}
+
+// WithMatchArg0Namespace matches messages whose first argument is a bus or
+// interface name in the given namespace, e.g. "com.example.backend" matches
+// "com.example.backend.foo".
+func WithMatchArg0Namespace(namespace string) MatchOption {
+	return WithMatchOption("arg0namespace", namespace)
+}
+
+// formatMatchOptions returns the match rule for the given options. Values are
+// quoted and apostrophes in them are escaped.
+func formatMatchOptions(options []MatchOption) string {
+	items := make([]string, 0, len(options))
+	for _, option := range options {
+		value := strings.Replace(option.value, "'", `'\''`, -1)
+		items = append(items, option.key+"='"+value+"'")
+	}
+	return strings.Join(items, ",")
+}
+
+// signalMatchRule returns the match rule for signals with the given options.
+// type='signal' is added unless the options already contain a type, as the
+// bus rejects rules with duplicate keys.
+func signalMatchRule(options []MatchOption) string {
+	for _, option := range options {
+		if option.key == "type" {
+			return formatMatchOptions(options)
+		}
+	}
+	return formatMatchOptions(append([]MatchOption{WithMatchType(TypeSignal)}, options...))
+}
+
+// AddMatchSignal adds a match rule for signals with the given options to the
+// bus, so that such signals are sent to this connection. Rules are reference
+// counted: if the same rule is added multiple times, it is only removed from
+// the bus when RemoveMatchSignal has been called as often.
+func (conn *Conn) AddMatchSignal(options ...MatchOption) error {
+	rule := signalMatchRule(options)
+	conn.matchLck.Lock()
+	defer conn.matchLck.Unlock()
+	if conn.matchRules[rule] == 0 {
+		err := conn.busObj.Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+		if err != nil {
+			return err
+		}
+	}
+	conn.matchRules[rule]++
+	return nil
+}
+
+// RemoveMatchSignal removes a match rule that was added with AddMatchSignal
+// and the same options.
+func (conn *Conn) RemoveMatchSignal(options ...MatchOption) error {
+	rule := signalMatchRule(options)
+	conn.matchLck.Lock()
+	defer conn.matchLck.Unlock()
+	if conn.matchRules[rule] > 1 {
+		conn.matchRules[rule]--
+		return nil
+	}
+	err := conn.busObj.Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err
+	if err != nil {
+		return err
+	}
+	delete(conn.matchRules, rule)
+	return nil
+}
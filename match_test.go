@@ -0,0 +1,90 @@
+package dbus
+
+import "testing"
+
+func TestFormatMatchOptions(t *testing.T) {
+	rule := formatMatchOptions([]MatchOption{
+		WithMatchType(TypeSignal),
+		WithMatchSender("org.freedesktop.DBus"),
+		WithMatchObjectPath("/org/freedesktop/DBus"),
+		WithMatchInterface("org.freedesktop.DBus"),
+		WithMatchMember("NameOwnerChanged"),
+		WithMatchArg(0, "it's"),
+		WithMatchArgPath(1, "/a/"),
+		WithMatchArg0Namespace("org.example"),
+	})
+	expected := "type='signal',sender='org.freedesktop.DBus',path='/org/freedesktop/DBus'," +
+		"interface='org.freedesktop.DBus',member='NameOwnerChanged',arg0='it'\\''s'," +
+		"arg1path='/a/',arg0namespace='org.example'"
+	if rule != expected {
+		t.Errorf("got %q, expected %q", rule, expected)
+	}
+}
+
+func TestSignalMatchRuleType(t *testing.T) {
+	rule := signalMatchRule([]MatchOption{WithMatchMember("Foo")})
+	if expected := "type='signal',member='Foo'"; rule != expected {
+		t.Errorf("got %q, expected %q", rule, expected)
+	}
+	rule = signalMatchRule([]MatchOption{WithMatchMember("Foo"), WithMatchType(TypeSignal)})
+	if expected := "member='Foo',type='signal'"; rule != expected {
+		t.Errorf("got %q, expected %q", rule, expected)
+	}
+
+	conn, err := SessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := []MatchOption{WithMatchType(TypeSignal), WithMatchMember("MatchType")}
+	if err = conn.AddMatchSignal(options...); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.RemoveMatchSignal(options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddMatchSignalRefCount(t *testing.T) {
+	conn, err := SessionBusPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+
+	options := []MatchOption{
+		WithMatchInterface("org.guelfey.DBus.Test"),
+		WithMatchMember("Match"),
+	}
+	rule := signalMatchRule(options)
+	for i := 0; i < 2; i++ {
+		if err = conn.AddMatchSignal(options...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.RemoveMatchSignal(options...); err != nil {
+		t.Fatal(err)
+	}
+	// the rule was added to the bus exactly once and is still there
+	if err = conn.busObj.Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err; err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.busObj.Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err; err == nil {
+		t.Error("rule was added to the bus more than once")
+	}
+
+	if err = conn.AddMatchSignal(options...); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.RemoveMatchSignal(options...); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.RemoveMatchSignal(options...); err == nil {
+		t.Error("rule was not removed from the bus")
+	}
+}
@@ -111,6 +111,7 @@ type Message struct {
 	Body    []interface{}
 
 	serial uint32
+	size   int // the size in bytes when it was last decoded or encoded
 }
 
 type header struct {
@@ -182,6 +183,7 @@ func DecodeMessage(rd io.Reader) (msg *Message, err error) {
 	}
 
 	dec.align(8)
+	msg.size = dec.pos + int(length)
 	body := make([]byte, int(length))
 	if length != 0 {
 		_, err := io.ReadFull(rd, body)
@@ -226,7 +228,7 @@ func (msg *Message) EncodeTo(out io.Writer, order binary.ByteOrder) error {
 	var body []byte
 	if len(msg.Body) != 0 {
 		var err error
-		body, err = Marshall(msg.Body...)
+		body, err = marshal(order, msg.Body...)
 		if err != nil {
 			return err
 		}
@@ -241,12 +243,13 @@ func (msg *Message) EncodeTo(out io.Writer, order binary.ByteOrder) error {
 		headers = append(headers, header{byte(k), v})
 	}
 	vs[6] = headers
-	h, err := Marshall(vs[:]...)
+	h, err := marshal(order, vs[:]...)
 	if err != nil {
 		return err
 	}
+	padding := (8 - len(h)%8) % 8
+	msg.size = len(h) + padding + len(body)
 	out.Write(h)
-	padding := 8 - len(h)%8
 	out.Write(make([]byte, padding))
 	out.Write(body)
 	return nil
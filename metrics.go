@@ -0,0 +1,129 @@
+package dbus
+
+import (
+	"time"
+)
+
+// Metrics receives events about the traffic on a connection, e.g. to export
+// them to a monitoring system; see SetMetrics. The package expvarmetrics
+// contains an implementation that publishes them with expvar.
+//
+// The methods are called synchronously by the goroutines that handle the
+// connection, so they must be safe for concurrent use and return quickly.
+type Metrics interface {
+	// MessageSent is called for every message that was sent, with its size
+	// in bytes.
+	MessageSent(typ Type, size int)
+
+	// MessageReceived is called for every message that was received, with
+	// its size in bytes.
+	MessageReceived(typ Type, size int)
+
+	// CallCompleted is called when an outgoing method call that expects a
+	// reply is done, with the time since it was sent and its error, if it
+	// failed.
+	CallCompleted(iface, member string, d time.Duration, err error)
+
+	// PendingCalls is called with the number of outgoing method calls that
+	// wait for their reply whenever it changes.
+	PendingCalls(n int)
+
+	// SignalDropped is called when a signal for a channel is discarded
+	// because the channel's queue is full (see SetSignalQueue).
+	SignalDropped()
+
+	// EavesdropDropped is called when an eavesdropped message is discarded
+	// because the channel passed to Eavesdrop is full.
+	EavesdropDropped()
+
+	// HandlerCompleted is called when an exported method returns, with the
+	// time it took and the error it returned.
+	HandlerCompleted(iface, member string, d time.Duration, err error)
+
+	// HandlerPanicked is called when an exported method panics, with the
+	// value passed to panic. The panic continues afterwards.
+	HandlerPanicked(iface, member string, v interface{})
+}
+
+// SetMetrics sets the Metrics that are notified about the traffic on conn.
+// Passing nil, the default, disables them.
+func (conn *Conn) SetMetrics(m Metrics) {
+	conn.metricsLck.Lock()
+	conn.metrics = m
+	conn.metricsLck.Unlock()
+}
+
+func (conn *Conn) getMetrics() Metrics {
+	conn.metricsLck.RLock()
+	defer conn.metricsLck.RUnlock()
+	return conn.metrics
+}
+
+// messageSent reports the message msg that was sent.
+func (conn *Conn) messageSent(msg *Message) {
+	if m := conn.getMetrics(); m != nil {
+		m.MessageSent(msg.Type, msg.size)
+	}
+}
+
+// messageReceived reports the message msg that was received.
+func (conn *Conn) messageReceived(msg *Message) {
+	if m := conn.getMetrics(); m != nil {
+		m.MessageReceived(msg.Type, msg.size)
+	}
+}
+
+// observeCall arranges for the completion of call, for which msg is sent, to
+// be reported.
+func (conn *Conn) observeCall(call *Call, msg *Message) {
+	m := conn.getMetrics()
+	if m == nil {
+		return
+	}
+	iface, _ := msg.Headers[FieldInterface].value.(string)
+	member, _ := msg.Headers[FieldMember].value.(string)
+	start := time.Now()
+	call.observe = func(call *Call) {
+		m.CallCompleted(iface, member, time.Since(start), call.Err)
+	}
+}
+
+// pendingCalls reports the number of pending calls.
+func (conn *Conn) pendingCalls(n int) {
+	if m := conn.getMetrics(); m != nil {
+		m.PendingCalls(n)
+	}
+}
+
+// signalDropped reports a discarded signal.
+func (conn *Conn) signalDropped() {
+	if m := conn.getMetrics(); m != nil {
+		m.SignalDropped()
+	}
+}
+
+// eavesdropDropped reports a discarded eavesdropped message.
+func (conn *Conn) eavesdropDropped() {
+	if m := conn.getMetrics(); m != nil {
+		m.EavesdropDropped()
+	}
+}
+
+// callHandler calls the exported method m and reports how long it took and
+// whether it panicked.
+func (conn *Conn) callHandler(m Method, iface, member string, args []interface{}) ([]interface{}, error) {
+	metrics := conn.getMetrics()
+	if metrics == nil {
+		return m.Call(args...)
+	}
+	start := time.Now()
+	defer func() {
+		if v := recover(); v != nil {
+			metrics.HandlerPanicked(iface, member, v)
+			panic(v)
+		}
+	}()
+	ret, err := m.Call(args...)
+	metrics.HandlerCompleted(iface, member, time.Since(start), err)
+	return ret, err
+}
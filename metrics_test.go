@@ -0,0 +1,134 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu       sync.Mutex
+	sent     map[Type]int
+	received map[Type]int
+	calls    []string
+	pending  []int
+	handlers []string
+	panics   []string
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{sent: make(map[Type]int), received: make(map[Type]int)}
+}
+
+func (m *testMetrics) MessageSent(typ Type, size int) {
+	m.mu.Lock()
+	m.sent[typ] += size
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) MessageReceived(typ Type, size int) {
+	m.mu.Lock()
+	m.received[typ] += size
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) CallCompleted(iface, member string, d time.Duration, err error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, iface+"."+member)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) PendingCalls(n int) {
+	m.mu.Lock()
+	m.pending = append(m.pending, n)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) SignalDropped()    {}
+func (m *testMetrics) EavesdropDropped() {}
+
+func (m *testMetrics) HandlerCompleted(iface, member string, d time.Duration, err error) {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, iface+"."+member)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) HandlerPanicked(iface, member string, v interface{}) {
+	m.mu.Lock()
+	m.panics = append(m.panics, iface+"."+member)
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	if err := server.Export(barExport{}, "/org/guelfey/DBus/Metrics", "org.guelfey.DBus.Test"); err != nil {
+		t.Fatal(err)
+	}
+	serverMetrics := newTestMetrics()
+	server.SetMetrics(serverMetrics)
+	clientMetrics := newTestMetrics()
+	client.SetMetrics(clientMetrics)
+
+	obj := client.Object(server.Names()[0], "/org/guelfey/DBus/Metrics")
+	if err := obj.Call("org.guelfey.DBus.Test.Foo", 0, "a").Err; err != nil {
+		t.Fatal(err)
+	}
+	client.SetMetrics(nil)
+	server.SetMetrics(nil)
+
+	clientMetrics.mu.Lock()
+	defer clientMetrics.mu.Unlock()
+	if clientMetrics.sent[TypeMethodCall] == 0 || clientMetrics.received[TypeMethodReply] == 0 {
+		t.Errorf("client: got %v sent and %v received", clientMetrics.sent, clientMetrics.received)
+	}
+	if len(clientMetrics.calls) != 1 || clientMetrics.calls[0] != "org.guelfey.DBus.Test.Foo" {
+		t.Errorf("client: got calls %v", clientMetrics.calls)
+	}
+	if p := clientMetrics.pending; len(p) != 2 || p[0] != 1 || p[1] != 0 {
+		t.Errorf("client: got pending calls %v", p)
+	}
+
+	serverMetrics.mu.Lock()
+	defer serverMetrics.mu.Unlock()
+	// the bus adds the sender to the call
+	if serverMetrics.received[TypeMethodCall] <= clientMetrics.sent[TypeMethodCall] {
+		t.Errorf("server: got %v received", serverMetrics.received)
+	}
+	if len(serverMetrics.handlers) != 1 || serverMetrics.handlers[0] != "org.guelfey.DBus.Test.Foo" {
+		t.Errorf("server: got handlers %v", serverMetrics.handlers)
+	}
+}
+
+func TestMessageSize(t *testing.T) {
+	msg := &Message{
+		Type: TypeSignal,
+		Headers: map[HeaderField]Variant{
+			FieldPath:      MakeVariant(ObjectPath("/org/guelfey/DBus/Metrics")),
+			FieldInterface: MakeVariant("org.guelfey.DBus.Test"),
+			FieldMember:    MakeVariant("Signal"),
+			FieldSignature: MakeVariant(SignatureOf("text", uint32(1))),
+		},
+		Body: []interface{}{"text", uint32(1)},
+	}
+	var buf bytes.Buffer
+	if err := msg.EncodeTo(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	size := buf.Len()
+	if msg.size != size {
+		t.Errorf("got size %d after encoding, expected %d", msg.size, size)
+	}
+	decoded, err := DecodeMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.size != size {
+		t.Errorf("got size %d, expected %d", decoded.size, size)
+	}
+}
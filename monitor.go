@@ -0,0 +1,115 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMonitor is the error returned when a message is sent on a connection in
+// monitor mode.
+var ErrMonitor = errors.New("dbus: connection is in monitor mode")
+
+// BecomeMonitor turns conn into a monitor by calling
+// org.freedesktop.DBus.Monitoring.BecomeMonitor with the given match rules.
+// If no rules are given, all messages are monitored.
+//
+// From then on, every message that the bus passes to conn (method calls,
+// replies, errors and signals) is sent to ch without further processing, with
+// its sender and serial intact. Only messages that are addressed to conn
+// itself are handled as usual. Unlike Eavesdrop, messages are not discarded
+// when ch is full; the connection waits until ch can receive, so it must be
+// read continuously. ch is closed when the connection is closed.
+//
+// Once BecomeMonitor returns successfully, conn can't send messages anymore;
+// all attempts to do so fail with ErrMonitor. Monitor mode can't be left, and
+// it can't be used on shared connections or with automatic reconnection.
+func (conn *Conn) BecomeMonitor(ch chan<- *Message, rules ...string) error {
+	if conn.reconnecting() {
+		return errors.New("dbus: monitor mode can't be used with automatic reconnection")
+	}
+	if conn.isShared() {
+		return errors.New("dbus: monitor mode can't be used on shared connections")
+	}
+	if rules == nil {
+		rules = []string{}
+	}
+	msg := &Message{
+		Type: TypeMethodCall,
+		Headers: map[HeaderField]Variant{
+			FieldDestination: MakeVariant("org.freedesktop.DBus"),
+			FieldPath:        MakeVariant(ObjectPath("/org/freedesktop/DBus")),
+			FieldInterface:   MakeVariant("org.freedesktop.DBus.Monitoring"),
+			FieldMember:      MakeVariant("BecomeMonitor"),
+			FieldSignature:   MakeVariant(SignatureOf(rules, uint32(0))),
+		},
+		Body: []interface{}{rules, uint32(0)},
+	}
+	msg.serial = conn.getSerial()
+
+	// the monitored messages may arrive right after the reply, so the
+	// monitor is set by inWorker when it receives the reply (see monitored)
+	conn.monitorLck.Lock()
+	if conn.monitor != nil || conn.pendingMonitor != nil {
+		conn.monitorLck.Unlock()
+		return errors.New("dbus: connection is already a monitor")
+	}
+	conn.pendingMonitor, conn.monitorSerial = ch, msg.serial
+	conn.monitorLck.Unlock()
+
+	call := <-conn.sendWithSerial(context.Background(), msg, nil).Done
+	conn.monitorLck.Lock()
+	conn.pendingMonitor, conn.monitorSerial = nil, 0
+	conn.monitorLck.Unlock()
+	return call.Err
+}
+
+// isShared reports whether conn is the connection returned by SessionBus or
+// SystemBus.
+func (conn *Conn) isShared() bool {
+	sessionBusLck.Lock()
+	shared := conn == sessionBus
+	sessionBusLck.Unlock()
+	systemBusLck.Lock()
+	shared = shared || conn == systemBus
+	systemBusLck.Unlock()
+	return shared
+}
+
+// monitored sends msg to the monitor channel and reports whether it did so,
+// which is the case if conn is a monitor and msg isn't addressed to conn. If
+// msg is the successful reply to BecomeMonitor, conn becomes a monitor.
+func (conn *Conn) monitored(msg *Message) bool {
+	conn.monitorLck.Lock()
+	ch := conn.monitor
+	if ch == nil && conn.pendingMonitor != nil && msg.Type == TypeMethodReply {
+		if serial, _ := msg.Headers[FieldReplySerial].value.(uint32); serial == conn.monitorSerial {
+			conn.monitor = conn.pendingMonitor
+			conn.pendingMonitor, conn.monitorSerial = nil, 0
+			conn.outHandler.setMonitor()
+		}
+	}
+	conn.monitorLck.Unlock()
+	if ch == nil {
+		return false
+	}
+	dest, _ := msg.Headers[FieldDestination].value.(string)
+	if dest != "" && conn.names.isKnownName(dest) {
+		return false
+	}
+	select {
+	case ch <- msg:
+	case <-conn.ctx.Done():
+	}
+	return true
+}
+
+// closeMonitor closes the monitor channel. It is called by inWorker when it
+// stops, as it is the only goroutine that sends to the channel.
+func (conn *Conn) closeMonitor() {
+	conn.monitorLck.Lock()
+	if conn.monitor != nil {
+		close(conn.monitor)
+	}
+	conn.monitor = nil
+	conn.monitorLck.Unlock()
+}
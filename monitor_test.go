@@ -0,0 +1,66 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBecomeMonitor(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+	monitor := connectSessionBus(t)
+	defer monitor.Close()
+
+	ch := make(chan *Message, 10)
+	shared, err := SessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.BecomeMonitor(ch); err == nil {
+		t.Error("shared connection became a monitor")
+	}
+	if err := monitor.BecomeMonitor(ch, "sender='"+client.Names()[0]+"'", "destination='"+client.Names()[0]+"'"); err != nil {
+		t.Fatal(err)
+	}
+
+	obj := client.Object(server.Names()[0], "/org/guelfey/DBus/Monitor")
+	if err := obj.Call("org.freedesktop.DBus.Peer.Ping", 0).Err; err != nil {
+		t.Fatal(err)
+	}
+	var call *Message
+	timeout := time.After(5 * time.Second)
+	for {
+		var msg *Message
+		select {
+		case msg = <-ch:
+		case <-timeout:
+			t.Fatal("call and reply not monitored")
+		}
+		sender, _ := msg.Headers[FieldSender].value.(string)
+		if msg.Type == TypeMethodCall && msg.Headers[FieldMember].value == "Ping" {
+			if sender != client.Names()[0] || msg.Serial() == 0 {
+				t.Errorf("unexpected call %v", msg)
+			}
+			call = msg
+		}
+		if msg.Type == TypeMethodReply && call != nil && msg.Headers[FieldReplySerial].value == call.Serial() {
+			if sender != server.Names()[0] {
+				t.Errorf("unexpected reply %v", msg)
+			}
+			break
+		}
+	}
+
+	if err := monitor.Emit("/org/guelfey/DBus/Monitor", "org.guelfey.DBus.Test.Signal"); err != ErrMonitor {
+		t.Errorf("Emit returned %v in monitor mode", err)
+	}
+	if err := monitor.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Err; err != ErrMonitor {
+		t.Errorf("Call returned %v in monitor mode", err)
+	}
+
+	monitor.Close()
+	for range ch {
+	}
+}
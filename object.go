@@ -41,7 +41,7 @@ func (o *Object) AddMatchSignal(iface, member string) *Call {
 	return o.Call(
 		"org.freedesktop.DBus.AddMatch",
 		0,
-		"type='signal',interface='"+iface+"',member='"+member+"'",
+		signalMatchRule([]MatchOption{WithMatchInterface(iface), WithMatchMember(member)}),
 	)
 }
 
@@ -77,7 +77,6 @@ func (o *Object) createCall(ctx context.Context, method string, flags Flags, ch
 	method = method[i+1:]
 	msg := new(Message)
 	msg.Type = TypeMethodCall
-	msg.serial = o.conn.getSerial()
 	msg.Flags = flags & (FlagNoAutoStart | FlagNoReplyExpected)
 	msg.Headers = make(map[HeaderField]Variant)
 	msg.Headers[FieldPath] = MakeVariant(o.path)
@@ -90,6 +89,10 @@ func (o *Object) createCall(ctx context.Context, method string, flags Flags, ch
 	if len(args) > 0 {
 		msg.Headers[FieldSignature] = MakeVariant(SignatureOf(args...))
 	}
+	if interceptors := o.conn.getClientInterceptors(); interceptors != nil {
+		return o.conn.interceptCall(ctx, msg, ch, interceptors)
+	}
+	msg.serial = o.conn.getSerial()
 	if msg.Flags&FlagNoReplyExpected == 0 {
 		if ch == nil {
 			ch = make(chan *Call, 10)
@@ -106,9 +109,10 @@ func (o *Object) createCall(ctx context.Context, method string, flags Flags, ch
 			ctxCanceler: cancel,
 			ctx:         ctx,
 		}
+		o.conn.observeCall(call, msg)
 		o.conn.calls.track(msg.serial, call)
-		o.conn.sendMessageAndIfClosed(msg, func() {
-			o.conn.calls.handleSendError(msg, ErrClosed)
+		o.conn.sendMessageAndIfClosed(msg, func(err error) {
+			o.conn.calls.handleSendError(msg, err)
 			cancel()
 		})
 		go func() {
@@ -127,8 +131,8 @@ func (o *Object) createCall(ctx context.Context, method string, flags Flags, ch
 		call.Done <- call
 		close(done)
 	}()
-	o.conn.sendMessageAndIfClosed(msg, func() {
-		call.Err = ErrClosed
+	o.conn.sendMessageAndIfClosed(msg, func(err error) {
+		call.Err = err
 	})
 	return call
 }
@@ -0,0 +1,243 @@
+package dbus
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const objectManagerIface = "org.freedesktop.DBus.ObjectManager"
+
+// PropertyProvider is implemented by values that are exported as
+// org.freedesktop.DBus.Properties and can list their properties, like
+// prop.Properties. The properties of such a value are reported by
+// ObjectManager and its interfaces are treated as interfaces of the object.
+type PropertyProvider interface {
+	// Interfaces returns the names of the interfaces that have properties.
+	Interfaces() []string
+
+	// GetAll returns the properties of the interface iface.
+	GetAll(iface string) (map[string]Variant, *Error)
+}
+
+// ObjectManager implements org.freedesktop.DBus.ObjectManager for all objects
+// below the path it is exported on. Objects are tracked as they are exported
+// and unexported with Export (including the Properties created by
+// prop.New), and the signals InterfacesAdded and InterfacesRemoved are
+// emitted automatically.
+//
+// ObjectManager must be created with ExportObjectManager.
+type ObjectManager struct {
+	conn *Conn
+	root ObjectPath
+
+	mu sync.Mutex
+	// the interfaces that were announced for each object
+	objects map[ObjectPath]map[string]bool
+}
+
+// ExportObjectManager exports a new ObjectManager as
+// org.freedesktop.DBus.ObjectManager on root. Passing nil to Export for root
+// and this interface stops it.
+func (conn *Conn) ExportObjectManager(root ObjectPath) (*ObjectManager, error) {
+	om := &ObjectManager{conn: conn}
+	if err := conn.Export(om, root, objectManagerIface); err != nil {
+		return nil, err
+	}
+	return om, nil
+}
+
+// GetManagedObjects implements
+// org.freedesktop.DBus.ObjectManager.GetManagedObjects.
+func (om *ObjectManager) GetManagedObjects() (map[ObjectPath]map[string]map[string]Variant, *Error) {
+	h := om.conn.handler.(*defaultHandler)
+	om.mu.Lock()
+	root := om.root
+	om.mu.Unlock()
+	objects := make(map[ObjectPath]map[string]map[string]Variant)
+	for _, path := range h.objectsBelow(root) {
+		obj := h.managedObject(path)
+		if len(obj.interfaces) > 0 {
+			objects[path] = obj.properties(obj.interfaces)
+		}
+	}
+	return objects, nil
+}
+
+// IntrospectInterface implements Introspector.
+func (om *ObjectManager) IntrospectInterface(iface string) string {
+	if iface != objectManagerIface {
+		return ""
+	}
+	return `<signal name="InterfacesAdded">
+			<arg name="object_path" type="o"/>
+			<arg name="interfaces_and_properties" type="a{sa{sv}}"/>
+		</signal>
+		<signal name="InterfacesRemoved">
+			<arg name="object_path" type="o"/>
+			<arg name="interfaces" type="as"/>
+		</signal>`
+}
+
+// start starts managing the objects below root without announcing the ones
+// that already exist.
+func (om *ObjectManager) start(root ObjectPath) {
+	h := om.conn.handler.(*defaultHandler)
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	om.root = root
+	om.objects = make(map[ObjectPath]map[string]bool)
+	for _, path := range h.objectsBelow(root) {
+		obj := h.managedObject(path)
+		if len(obj.interfaces) > 0 {
+			om.objects[path] = obj.set()
+		}
+	}
+}
+
+// update emits InterfacesAdded and InterfacesRemoved for the changes of the
+// interfaces on path since the last call.
+func (om *ObjectManager) update(path ObjectPath) {
+	h := om.conn.handler.(*defaultHandler)
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	old := om.objects[path]
+	obj := h.managedObject(path)
+	current := obj.set()
+	var added, removed []string
+	for _, name := range obj.interfaces {
+		if !old[name] {
+			added = append(added, name)
+		}
+	}
+	for name := range old {
+		if !current[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	if len(current) > 0 {
+		om.objects[path] = current
+	} else {
+		delete(om.objects, path)
+	}
+	if len(added) > 0 {
+		om.conn.Emit(om.root, objectManagerIface+".InterfacesAdded", path, obj.properties(added))
+	}
+	if len(removed) > 0 {
+		om.conn.Emit(om.root, objectManagerIface+".InterfacesRemoved", path, removed)
+	}
+}
+
+// managedObject describes the interfaces of an exported object.
+type managedObject struct {
+	interfaces []string
+	props      PropertyProvider
+}
+
+func (obj managedObject) set() map[string]bool {
+	set := make(map[string]bool, len(obj.interfaces))
+	for _, name := range obj.interfaces {
+		set[name] = true
+	}
+	return set
+}
+
+// properties returns the properties of the given interfaces in the format
+// used by the ObjectManager interface.
+func (obj managedObject) properties(interfaces []string) map[string]map[string]Variant {
+	m := make(map[string]map[string]Variant, len(interfaces))
+	for _, name := range interfaces {
+		var props map[string]Variant
+		if obj.props != nil {
+			props, _ = obj.props.GetAll(name)
+		}
+		if props == nil {
+			props = make(map[string]Variant)
+		}
+		m[name] = props
+	}
+	return m
+}
+
+// managedObject returns the interfaces of the object on path, including the
+// ones of the PropertyProvider exported on it.
+func (h *defaultHandler) managedObject(path ObjectPath) managedObject {
+	h.RLock()
+	object, ok := h.objects[path]
+	h.RUnlock()
+	var obj managedObject
+	if !ok {
+		return obj
+	}
+	exported := make(map[string]bool)
+	object.mu.RLock()
+	for name := range object.interfaces {
+		exported[name] = true
+		obj.interfaces = append(obj.interfaces, name)
+	}
+	if intf, ok := object.interfaces[propertiesIface]; ok {
+		obj.props, _ = intf.value.(PropertyProvider)
+	}
+	object.mu.RUnlock()
+	if obj.props != nil {
+		for _, name := range obj.props.Interfaces() {
+			if !exported[name] {
+				obj.interfaces = append(obj.interfaces, name)
+			}
+		}
+	}
+	sort.Strings(obj.interfaces)
+	return obj
+}
+
+// objectsBelow returns the paths of all objects below root.
+func (h *defaultHandler) objectsBelow(root ObjectPath) []ObjectPath {
+	h.RLock()
+	defer h.RUnlock()
+	var paths []ObjectPath
+	for path := range h.objects {
+		if isBelow(path, root) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// isBelow reports whether path is a descendant of root.
+func isBelow(path, root ObjectPath) bool {
+	if root == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(string(path), string(root)+"/")
+}
+
+// addObjectManager registers om as the manager for the objects below root.
+func (conn *Conn) addObjectManager(root ObjectPath, om *ObjectManager) {
+	om.start(root)
+	conn.objectManagersLck.Lock()
+	conn.objectManagers[root] = om
+	conn.objectManagersLck.Unlock()
+}
+
+func (conn *Conn) removeObjectManager(root ObjectPath) {
+	conn.objectManagersLck.Lock()
+	delete(conn.objectManagers, root)
+	conn.objectManagersLck.Unlock()
+}
+
+// objectChanged informs the object managers of the objects containing path
+// that the interfaces of path changed.
+func (conn *Conn) objectChanged(path ObjectPath) {
+	var managers []*ObjectManager
+	conn.objectManagersLck.Lock()
+	for root, om := range conn.objectManagers {
+		if isBelow(path, root) {
+			managers = append(managers, om)
+		}
+	}
+	conn.objectManagersLck.Unlock()
+	for _, om := range managers {
+		om.update(path)
+	}
+}
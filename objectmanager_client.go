@@ -0,0 +1,274 @@
+package dbus
+
+import (
+	"sync"
+)
+
+// ObjectEventType is the kind of change described by an ObjectEvent.
+type ObjectEventType int
+
+const (
+	// ObjectEventAdded means that interfaces were added to an object, which
+	// may be new.
+	ObjectEventAdded ObjectEventType = iota
+	// ObjectEventRemoved means that interfaces were removed from an object.
+	// The object is gone if it has no interfaces left.
+	ObjectEventRemoved
+	// ObjectEventPropertiesChanged means that properties of an interface of
+	// an object changed.
+	ObjectEventPropertiesChanged
+)
+
+// ObjectEvent describes a change of the objects of an ObjectManagerClient.
+type ObjectEvent struct {
+	Type ObjectEventType
+	Path ObjectPath
+
+	// Added contains the added interfaces and their properties for
+	// ObjectEventAdded.
+	Added map[string]map[string]Variant
+
+	// Removed contains the removed interfaces for ObjectEventRemoved.
+	Removed []string
+
+	// Interface, Changed and Invalidated describe the change for
+	// ObjectEventPropertiesChanged. Invalidated properties are removed from
+	// the cache.
+	Interface   string
+	Changed     map[string]Variant
+	Invalidated []string
+}
+
+// ObjectManagerClient keeps a local copy of the objects of a remote
+// org.freedesktop.DBus.ObjectManager and their properties. It is updated with
+// the signals InterfacesAdded, InterfacesRemoved and PropertiesChanged and
+// is safe for concurrent use by multiple goroutines.
+type ObjectManagerClient struct {
+	ch     chan *Signal
+	subs   []*Subscription
+	ready  chan error
+	done   chan struct{}
+	closed sync.Once
+
+	mu      sync.RWMutex
+	objects map[ObjectPath]map[string]map[string]Variant
+	notify  []chan<- ObjectEvent
+}
+
+// NewObjectManagerClient subscribes to the signals of the ObjectManager obj
+// (which must be an object of conn), calls its GetManagedObjects method and
+// returns a client that contains the result and keeps it up to date until
+// Close is called or the connection is closed.
+func NewObjectManagerClient(conn *Conn, obj BusObject) (*ObjectManagerClient, error) {
+	c := &ObjectManagerClient{
+		ch:      make(chan *Signal, 64),
+		ready:   make(chan error, 1),
+		done:    make(chan struct{}),
+		objects: make(map[ObjectPath]map[string]map[string]Variant),
+	}
+	sub, err := conn.Subscribe(c.ch,
+		WithMatchSender(obj.Destination()),
+		WithMatchObjectPath(obj.Path()),
+		WithMatchInterface(objectManagerIface))
+	if err != nil {
+		return nil, err
+	}
+	c.subs = append(c.subs, sub)
+	// the client never blocks on anything else than the channel, so it is
+	// safe to make the connection wait for it.
+	conn.SetSignalQueue(c.ch, defaultSignalQueueSize, OverflowBlock)
+	sub, err = conn.Subscribe(c.ch,
+		WithMatchSender(obj.Destination()),
+		WithMatchPathNamespace(obj.Path()),
+		WithMatchInterface(propertiesIface),
+		WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.subs = append(c.subs, sub)
+
+	// The reply is awaited by run, as the signals that arrive in the
+	// meantime have to be read.
+	call := obj.Go(objectManagerIface+".GetManagedObjects", 0, nil)
+	go c.run(call)
+	if err := <-c.ready; err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close stops updating the client and removes its match rules.
+func (c *ObjectManagerClient) Close() error {
+	var err error
+	c.closed.Do(func() {
+		// the channel is read until the match rules are removed, as the
+		// replies can't be received while the connection waits for it.
+		for _, sub := range c.subs {
+			if e := sub.Unsubscribe(); e != nil {
+				err = e
+			}
+		}
+		close(c.done)
+	})
+	return err
+}
+
+// Notify registers ch to receive the changes of the objects. If ch is full
+// when an event is sent, the event is discarded.
+func (c *ObjectManagerClient) Notify(ch chan<- ObjectEvent) {
+	c.mu.Lock()
+	c.notify = append(c.notify, ch)
+	c.mu.Unlock()
+}
+
+// Objects returns a copy of all objects, their interfaces and their
+// properties.
+func (c *ObjectManagerClient) Objects() map[ObjectPath]map[string]map[string]Variant {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	objects := make(map[ObjectPath]map[string]map[string]Variant, len(c.objects))
+	for path, obj := range c.objects {
+		objects[path] = copyInterfaces(obj)
+	}
+	return objects
+}
+
+// Object returns a copy of the interfaces and properties of the object on
+// path.
+func (c *ObjectManagerClient) Object(path ObjectPath) (map[string]map[string]Variant, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	obj, ok := c.objects[path]
+	if !ok {
+		return nil, false
+	}
+	return copyInterfaces(obj), true
+}
+
+// Property returns the cached value of a property.
+func (c *ObjectManagerClient) Property(path ObjectPath, iface, name string) (Variant, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.objects[path][iface][name]
+	return v, ok
+}
+
+func copyInterfaces(obj map[string]map[string]Variant) map[string]map[string]Variant {
+	m := make(map[string]map[string]Variant, len(obj))
+	for iface, props := range obj {
+		p := make(map[string]Variant, len(props))
+		for name, v := range props {
+			p[name] = v
+		}
+		m[iface] = p
+	}
+	return m
+}
+
+func (c *ObjectManagerClient) run(call *Call) {
+	// signals received before the reply are applied again after it; this
+	// doesn't change the result, as every change overwrites the previous
+	// state.
+	var pending []*Signal
+	var err error
+	for call != nil {
+		select {
+		case sig, ok := <-c.ch:
+			if !ok {
+				c.ready <- ErrClosed
+				return
+			}
+			pending = append(pending, sig)
+		case <-call.Done:
+			var objects map[ObjectPath]map[string]map[string]Variant
+			if err = call.Store(&objects); err == nil {
+				c.mu.Lock()
+				c.objects = objects
+				c.mu.Unlock()
+				for _, sig := range pending {
+					c.handleSignal(sig)
+				}
+			}
+			call = nil
+		}
+	}
+	c.ready <- err
+	for {
+		select {
+		case sig, ok := <-c.ch:
+			if !ok {
+				return
+			}
+			if err == nil {
+				c.handleSignal(sig)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *ObjectManagerClient) handleSignal(sig *Signal) {
+	var event ObjectEvent
+	switch sig.Name {
+	case objectManagerIface + ".InterfacesAdded":
+		event.Type = ObjectEventAdded
+		if Store(sig.Body, &event.Path, &event.Added) != nil {
+			return
+		}
+		c.mu.Lock()
+		obj, ok := c.objects[event.Path]
+		if !ok {
+			obj = make(map[string]map[string]Variant)
+			c.objects[event.Path] = obj
+		}
+		for iface, props := range copyInterfaces(event.Added) {
+			obj[iface] = props
+		}
+	case objectManagerIface + ".InterfacesRemoved":
+		event.Type = ObjectEventRemoved
+		if Store(sig.Body, &event.Path, &event.Removed) != nil {
+			return
+		}
+		c.mu.Lock()
+		if obj, ok := c.objects[event.Path]; ok {
+			for _, iface := range event.Removed {
+				delete(obj, iface)
+			}
+			if len(obj) == 0 {
+				delete(c.objects, event.Path)
+			}
+		}
+	case propertiesIface + ".PropertiesChanged":
+		event.Type = ObjectEventPropertiesChanged
+		event.Path = sig.Path
+		if Store(sig.Body, &event.Interface, &event.Changed, &event.Invalidated) != nil {
+			return
+		}
+		c.mu.Lock()
+		props, ok := c.objects[event.Path][event.Interface]
+		if !ok {
+			// not an object of the manager
+			c.mu.Unlock()
+			return
+		}
+		for name, v := range event.Changed {
+			props[name] = v
+		}
+		for _, name := range event.Invalidated {
+			delete(props, name)
+		}
+	default:
+		return
+	}
+	notify := c.notify
+	c.mu.Unlock()
+	for _, ch := range notify {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package dbus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testProperties map[string]map[string]Variant
+
+func (p testProperties) Get(iface, name string) (Variant, *Error) {
+	return p[iface][name], nil
+}
+
+func (p testProperties) GetAll(iface string) (map[string]Variant, *Error) {
+	return p[iface], nil
+}
+
+func (p testProperties) Interfaces() []string {
+	var s []string
+	for iface := range p {
+		s = append(s, iface)
+	}
+	return s
+}
+
+func receiveSignal(t *testing.T, ch <-chan *Signal) *Signal {
+	select {
+	case sig := <-ch:
+		return sig
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal not received")
+	}
+	return nil
+}
+
+func TestObjectManager(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	const root = "/org/guelfey/DBus/Manager"
+	server.Export(barExport{}, root+"/a", "org.guelfey.DBus.Test")
+	if _, err := server.ExportObjectManager(root); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *Signal, 10)
+	_, err := client.Subscribe(ch,
+		WithMatchSender(server.Names()[0]), WithMatchInterface("org.freedesktop.DBus.ObjectManager"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props := testProperties{"org.guelfey.DBus.Props": {"Count": MakeVariant(uint32(3))}}
+	server.Export(props, root+"/b", "org.freedesktop.DBus.Properties")
+	sig := receiveSignal(t, ch)
+	var (
+		path       ObjectPath
+		interfaces map[string]map[string]Variant
+	)
+	if err := Store(sig.Body, &path, &interfaces); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]Variant{
+		"org.freedesktop.DBus.Properties": {},
+		"org.guelfey.DBus.Props":          {"Count": MakeVariant(uint32(3))},
+	}
+	if sig.Name != "org.freedesktop.DBus.ObjectManager.InterfacesAdded" || sig.Path != root ||
+		path != root+"/b" || !reflect.DeepEqual(interfaces, expected) {
+		t.Errorf("unexpected signal %v", sig)
+	}
+
+	var objects map[ObjectPath]map[string]map[string]Variant
+	err = client.Object(server.Names()[0], root).Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[root+"/a"]["org.guelfey.DBus.Test"] == nil ||
+		!reflect.DeepEqual(objects[root+"/b"], expected) {
+		t.Errorf("unexpected managed objects %v", objects)
+	}
+
+	server.Export(nil, root+"/b", "org.freedesktop.DBus.Properties")
+	sig = receiveSignal(t, ch)
+	var removed []string
+	if err := Store(sig.Body, &path, &removed); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Name != "org.freedesktop.DBus.ObjectManager.InterfacesRemoved" || path != root+"/b" ||
+		!reflect.DeepEqual(removed, []string{"org.freedesktop.DBus.Properties", "org.guelfey.DBus.Props"}) {
+		t.Errorf("unexpected signal %v", sig)
+	}
+
+	// objects outside of the subtree are not managed
+	server.Export(barExport{}, "/org/guelfey/DBus/Other", "org.guelfey.DBus.Test")
+	server.Export(nil, root, "org.freedesktop.DBus.ObjectManager")
+	server.Export(barExport{}, root+"/c", "org.guelfey.DBus.Test")
+	select {
+	case sig := <-ch:
+		t.Errorf("unexpected signal %v", sig)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func receiveObjectEvent(t *testing.T, ch <-chan ObjectEvent, typ ObjectEventType) ObjectEvent {
+	select {
+	case event := <-ch:
+		if event.Type != typ {
+			t.Fatalf("received event %v, expected type %v", event, typ)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+	}
+	return ObjectEvent{}
+}
+
+func TestObjectManagerClient(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	const root = "/org/guelfey/DBus/Manager"
+	props := testProperties{"org.guelfey.DBus.Props": {"Count": MakeVariant(uint32(3))}}
+	server.Export(props, root+"/a", "org.freedesktop.DBus.Properties")
+	if _, err := server.ExportObjectManager(root); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewObjectManagerClient(client, client.Object(server.Names()[0], root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	events := make(chan ObjectEvent, 10)
+	c.Notify(events)
+
+	if v, ok := c.Property(root+"/a", "org.guelfey.DBus.Props", "Count"); !ok || v.Value() != uint32(3) {
+		t.Errorf("unexpected initial value %v", v)
+	}
+
+	server.Export(barExport{}, root+"/b", "org.guelfey.DBus.Test")
+	event := receiveObjectEvent(t, events, ObjectEventAdded)
+	if event.Path != root+"/b" || event.Added["org.guelfey.DBus.Test"] == nil {
+		t.Errorf("unexpected event %v", event)
+	}
+	if len(c.Objects()) != 2 {
+		t.Errorf("unexpected objects %v", c.Objects())
+	}
+
+	server.Emit(root+"/a", "org.freedesktop.DBus.Properties.PropertiesChanged",
+		"org.guelfey.DBus.Props", map[string]Variant{"Count": MakeVariant(uint32(4))}, []string{})
+	event = receiveObjectEvent(t, events, ObjectEventPropertiesChanged)
+	if event.Path != root+"/a" || event.Interface != "org.guelfey.DBus.Props" {
+		t.Errorf("unexpected event %v", event)
+	}
+	if v, _ := c.Property(root+"/a", "org.guelfey.DBus.Props", "Count"); v.Value() != uint32(4) {
+		t.Errorf("unexpected value %v after PropertiesChanged", v)
+	}
+
+	server.Export(nil, root+"/b", "org.guelfey.DBus.Test")
+	event = receiveObjectEvent(t, events, ObjectEventRemoved)
+	if _, ok := c.Object(root + "/b"); ok || event.Path != root+"/b" {
+		t.Errorf("object not removed: %v", event)
+	}
+}
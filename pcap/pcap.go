@@ -0,0 +1,186 @@
+// Package pcap reads and writes D-Bus messages in the pcap capture file
+// format, using the link type LINKTYPE_DBUS. Such files are written by
+// busctl capture and can be opened with Wireshark.
+//
+// Messages that a connection sends and receives can be recorded with
+// dbus.Conn.SetCapture:
+//
+//	w, err := pcap.NewWriter(f)
+//	...
+//	conn.SetCapture(w.Capture)
+//
+// A Reader returns the recorded messages, e.g. to replay them in tests.
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// LinkTypeDBus is the pcap link type of D-Bus messages.
+const LinkTypeDBus = 231
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+
+	// snapLen is the maximal size of a D-Bus message.
+	snapLen = 1 << 27
+)
+
+var (
+	// ErrFormat is returned by NewReader if the data isn't a pcap file.
+	ErrFormat = errors.New("pcap: not a pcap file")
+
+	// ErrLinkType is returned by NewReader for pcap files that don't contain
+	// D-Bus messages.
+	ErrLinkType = errors.New("pcap: link type is not D-Bus")
+
+	// ErrTruncated is returned by ReadMessage for messages that weren't
+	// captured completely. The next message can still be read.
+	ErrTruncated = errors.New("pcap: truncated message")
+)
+
+// Writer writes messages to a pcap file. It is safe for concurrent use by
+// multiple goroutines.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+}
+
+// NewWriter writes the header of a pcap file to w and returns a Writer that
+// appends messages to it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], magicMicroseconds)
+	binary.LittleEndian.PutUint16(header[4:], 2) // version 2.4
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], snapLen)
+	binary.LittleEndian.PutUint32(header[20:], LinkTypeDBus)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteMessage writes msg with the timestamp t.
+func (w *Writer) WriteMessage(msg *dbus.Message, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset()
+	// leave room for the record header
+	w.buf.Write(make([]byte, 16))
+	if err := msg.EncodeTo(&w.buf, binary.LittleEndian); err != nil {
+		return err
+	}
+	record := w.buf.Bytes()
+	size := uint32(len(record) - 16)
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], size)
+	binary.LittleEndian.PutUint32(record[12:], size)
+	_, err := w.w.Write(record)
+	return err
+}
+
+// Capture writes msg with the current time. It can be passed to
+// dbus.Conn.SetCapture. Errors are reported by Err.
+func (w *Writer) Capture(msg *dbus.Message, sent bool) {
+	if err := w.WriteMessage(msg, time.Now()); err != nil {
+		w.mu.Lock()
+		if w.err == nil {
+			w.err = err
+		}
+		w.mu.Unlock()
+	}
+}
+
+// Err returns the first error that occurred in Capture.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Reader reads messages from a pcap file.
+type Reader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	nano  bool
+	buf   []byte
+}
+
+// NewReader reads the header of the pcap file in r and returns a Reader for
+// its messages.
+func NewReader(r io.Reader) (*Reader, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	rd := &Reader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header[0:]) {
+		case magicMicroseconds:
+			rd.order = order
+		case magicNanoseconds:
+			rd.order = order
+			rd.nano = true
+		}
+	}
+	if rd.order == nil {
+		return nil, ErrFormat
+	}
+	// the upper bits of the link type may contain flags
+	if rd.order.Uint32(header[20:])&0xffff != LinkTypeDBus {
+		return nil, ErrLinkType
+	}
+	return rd, nil
+}
+
+// ReadMessage returns the next message and the time it was captured at. At
+// the end of the file, it returns io.EOF.
+func (r *Reader) ReadMessage() (*dbus.Message, time.Time, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrTruncated
+		}
+		return nil, time.Time{}, err
+	}
+	sec := int64(r.order.Uint32(header[0:]))
+	frac := int64(r.order.Uint32(header[4:]))
+	if !r.nano {
+		frac *= 1000
+	}
+	t := time.Unix(sec, frac)
+	captured, size := r.order.Uint32(header[8:]), r.order.Uint32(header[12:])
+	if captured > snapLen {
+		return nil, t, errors.New("pcap: invalid record length")
+	}
+	if uint32(cap(r.buf)) < captured {
+		r.buf = make([]byte, captured)
+	}
+	data := r.buf[:captured]
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrTruncated
+		}
+		return nil, t, err
+	}
+	if captured < size {
+		return nil, t, ErrTruncated
+	}
+	msg, err := dbus.DecodeMessage(bytes.NewReader(data))
+	return msg, t, err
+}
@@ -0,0 +1,141 @@
+package pcap
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func testSignal(member string, body ...interface{}) *dbus.Message {
+	return &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldPath:      dbus.MakeVariant(dbus.ObjectPath("/org/example")),
+			dbus.FieldInterface: dbus.MakeVariant("org.example.Test"),
+			dbus.FieldMember:    dbus.MakeVariant(member),
+			dbus.FieldSignature: dbus.MakeVariant(dbus.SignatureOf(body...)),
+		},
+		Body: body,
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []*dbus.Message{
+		testSignal("First", "text", uint32(42)),
+		testSignal("Second", map[string]dbus.Variant{"key": dbus.MakeVariant(uint32(1))}),
+	}
+	start := time.Unix(1500000000, 123456789)
+	for i, msg := range msgs {
+		if err := w.WriteMessage(msg, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range msgs {
+		msg, ts, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != expected.Type || !reflect.DeepEqual(msg.Headers, expected.Headers) ||
+			!reflect.DeepEqual(msg.Body, expected.Body) {
+			t.Errorf("message %d: got %v, expected %v", i, msg, expected)
+		}
+		// timestamps are stored with microsecond precision
+		if want := start.Add(time.Duration(i) * time.Second).Truncate(time.Microsecond); !ts.Equal(want) {
+			t.Errorf("message %d: got time %v, expected %v", i, ts, want)
+		}
+	}
+	if _, _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("got %v at the end of the file, expected EOF", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	other := append([]byte(nil), data...)
+	other[20] = 1 // Ethernet
+	if _, err := NewReader(bytes.NewReader(other)); err != ErrLinkType {
+		t.Errorf("got %v for other link type", err)
+	}
+	if _, err := NewReader(bytes.NewReader(data[:10])); err != ErrFormat {
+		t.Errorf("got %v for short header", err)
+	}
+
+	if err := w.WriteMessage(testSignal("Test"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.ReadMessage(); err != ErrTruncated {
+		t.Errorf("got %v for truncated message", err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetCapture(w.Capture)
+	if err = conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetCapture(nil)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call, _, err := r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.Type != dbus.TypeMethodCall || call.Headers[dbus.FieldMember].Value() != "Hello" {
+		t.Errorf("unexpected first message %v", call)
+	}
+	for {
+		msg, _, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("reply to Hello not captured: %v", err)
+		}
+		if msg.Type == dbus.TypeMethodReply {
+			if msg.Headers[dbus.FieldReplySerial].Value() != call.Serial() {
+				t.Errorf("unexpected reply %v", msg)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package prop
+
+import (
+	"github.com/godbus/dbus"
+)
+
+// Computed can be used as the Value of a Prop whose value is computed by a
+// function on every Get and GetAll instead of being stored.
+//
+// As the properties can't detect changes of the value, PropertiesChanged has to
+// be triggered with Invalidate.
+type Computed struct {
+	// Type is the signature of the values returned by Get.
+	Type dbus.Signature
+
+	// Get returns the current value. If it fails, the error is returned to
+	// the caller; a *dbus.Error is sent as it is, other errors as
+	// org.freedesktop.DBus.Error.Failed.
+	Get func() (interface{}, error)
+
+	// Set is called to change the value if the Prop is writable. If it is
+	// nil, the property can't be changed.
+	Set func(v interface{}) error
+}
+
+func (c Computed) get() (interface{}, *dbus.Error) {
+	v, err := c.Get()
+	if err != nil {
+		return nil, toError(err)
+	}
+	return v, nil
+}
+
+func (c Computed) set(v interface{}) *dbus.Error {
+	if c.Set == nil {
+		return ErrReadOnly
+	}
+	if err := c.Set(v); err != nil {
+		return toError(err)
+	}
+	return nil
+}
+
+func (c Computed) signature() dbus.Signature {
+	return c.Type
+}
+
+func (c Computed) readable() bool {
+	return c.Get != nil
+}
+
+func (c Computed) settable() bool {
+	return c.Set != nil
+}
+
+func toError(err error) *dbus.Error {
+	if e, ok := err.(*dbus.Error); ok {
+		return e
+	}
+	if e, ok := err.(dbus.Error); ok {
+		return &e
+	}
+	return dbus.MakeFailedError(err)
+}
+
+// Invalidate emits PropertiesChanged for the given property to announce that
+// its value changed without including the new value. It is meant for
+// properties whose Value is Computed.
+func (p *Properties) Invalidate(iface, property string) *dbus.Error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	prop, err := p.lookup(iface, property)
+	if err != nil {
+		return err
+	}
+	if prop.Emit == EmitFalse || prop.Emit == EmitConst {
+		return nil
+	}
+	c := make(changes)
+	c.add(iface, property, EmitInvalidates, nil)
+	p.emit(c)
+	return nil
+}
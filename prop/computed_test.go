@@ -0,0 +1,81 @@
+package prop
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestComputed(t *testing.T) {
+	conn := connectSessionBus(t)
+	defer conn.Close()
+	const path = "/org/guelfey/DBus/Computed"
+	ch := make(chan *dbus.Signal, 10)
+	_, err := conn.Subscribe(ch, dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"), dbus.WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	level := uint8(50)
+	var fail error
+	p := New(conn, path, map[string]map[string]*Prop{
+		"org.example.Battery": {
+			"Level": {
+				Value: Computed{
+					Type: dbus.SignatureOf(uint8(0)),
+					Get: func() (interface{}, error) {
+						return level, fail
+					},
+				},
+				Emit: EmitInvalidates,
+			},
+		},
+	})
+
+	v, derr := p.Get("org.example.Battery", "Level")
+	if derr != nil || v.Value() != uint8(50) {
+		t.Errorf("Get returned %v, %v", v, derr)
+	}
+	level = 20
+	all, derr := p.GetAll("org.example.Battery")
+	if derr != nil || all["Level"].Value() != uint8(20) {
+		t.Errorf("GetAll returned %v, %v", all, derr)
+	}
+	if derr := p.Set("org.example.Battery", "Level", dbus.MakeVariant(uint8(1))); derr != ErrReadOnly {
+		t.Errorf("Set returned %v", derr)
+	}
+
+	fail = errors.New("no battery")
+	if _, derr := p.Get("org.example.Battery", "Level"); derr == nil || derr.Name != "org.freedesktop.DBus.Error.Failed" {
+		t.Errorf("Get returned %v for a failing getter", derr)
+	}
+	if _, derr := p.GetAll("org.example.Battery"); derr == nil {
+		t.Error("GetAll succeeded with a failing getter")
+	}
+
+	if derr := p.Invalidate("org.example.Battery", "Level"); derr != nil {
+		t.Fatal(derr)
+	}
+	select {
+	case sig := <-ch:
+		var (
+			iface       string
+			changed     map[string]dbus.Variant
+			invalidated []string
+		)
+		if err := dbus.Store(sig.Body, &iface, &changed, &invalidated); err != nil {
+			t.Fatal(err)
+		}
+		if len(changed) != 0 || len(invalidated) != 1 || invalidated[0] != "Level" {
+			t.Errorf("unexpected changes %v, %v", changed, invalidated)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PropertiesChanged not received")
+	}
+	if derr := p.Invalidate("org.example.Battery", "Missing"); derr != ErrPropNotFound {
+		t.Errorf("Invalidate returned %v for a missing property", derr)
+	}
+}
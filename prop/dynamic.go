@@ -0,0 +1,147 @@
+package prop
+
+import (
+	"github.com/godbus/dbus"
+)
+
+// AddInterface adds the properties of an interface, replacing the ones it had
+// before. If the interface is new and an ObjectManager manages the object,
+// InterfacesAdded is emitted.
+func (p *Properties) AddInterface(iface string, props map[string]*Prop) {
+	p.mut.Lock()
+	if p.m == nil {
+		p.m = make(map[string]map[string]*Prop)
+	}
+	_, exists := p.m[iface]
+	if props == nil {
+		props = make(map[string]*Prop)
+	}
+	p.m[iface] = props
+	p.mut.Unlock()
+	if !exists {
+		p.interfacesChanged()
+	}
+}
+
+// RemoveInterface removes the properties of an interface. If an ObjectManager
+// manages the object, InterfacesRemoved is emitted.
+func (p *Properties) RemoveInterface(iface string) {
+	p.mut.Lock()
+	_, exists := p.m[iface]
+	delete(p.m, iface)
+	p.mut.Unlock()
+	if exists {
+		p.interfacesChanged()
+	}
+}
+
+// AddProperty adds a property to an interface, which is added if it doesn't
+// exist yet (see AddInterface). PropertiesChanged is emitted for the new
+// property as if it had been set.
+func (p *Properties) AddProperty(iface, property string, prop *Prop) *dbus.Error {
+	p.mut.Lock()
+	if p.m == nil {
+		p.m = make(map[string]map[string]*Prop)
+	}
+	m, exists := p.m[iface]
+	if !exists {
+		m = make(map[string]*Prop)
+		p.m[iface] = m
+	}
+	m[property] = prop
+	if exists {
+		c := make(changes)
+		v, err := prop.get()
+		if err == ErrWriteOnly {
+			err = nil
+		} else if err == nil {
+			c.add(iface, property, prop.Emit, v)
+		}
+		p.emit(c)
+		p.mut.Unlock()
+		return err
+	}
+	p.mut.Unlock()
+	p.interfacesChanged()
+	return nil
+}
+
+// RemoveProperty removes a property and emits PropertiesChanged to
+// invalidate it. If it was the last property of the interface, the interface
+// is removed (see RemoveInterface).
+func (p *Properties) RemoveProperty(iface, property string) *dbus.Error {
+	p.mut.Lock()
+	m, ok := p.m[iface]
+	if !ok {
+		p.mut.Unlock()
+		return ErrIfaceNotFound
+	}
+	prop, ok := m[property]
+	if !ok {
+		p.mut.Unlock()
+		return ErrPropNotFound
+	}
+	delete(m, property)
+	if len(m) == 0 {
+		delete(p.m, iface)
+		p.mut.Unlock()
+		p.interfacesChanged()
+		return nil
+	}
+	if prop.Emit != EmitFalse && prop.Emit != EmitConst {
+		c := make(changes)
+		c.add(iface, property, EmitInvalidates, nil)
+		p.emit(c)
+	}
+	p.mut.Unlock()
+	return nil
+}
+
+// interfacesChanged exports p again, so that the connection sees the new set
+// of interfaces; this updates the introspection data and makes an
+// ObjectManager announce the change. p.mut must not be locked.
+func (p *Properties) interfacesChanged() {
+	p.conn.Export(p, p.path, "org.freedesktop.DBus.Properties")
+}
+
+// GetValue returns the value of the given property. Unlike GetMust, it
+// returns an error if the interface or the property don't exist or the value
+// can't be read.
+func (p *Properties) GetValue(iface, property string) (interface{}, *dbus.Error) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	prop, err := p.lookup(iface, property)
+	if err != nil {
+		return nil, err
+	}
+	return prop.get()
+}
+
+// SetValue sets the value of the given property and emits PropertiesChanged
+// if appropiate. Unlike SetMust, it returns an error if the interface or the
+// property don't exist or the value can't be stored. As with SetMust, the
+// property doesn't need to be writable and no callback is called.
+func (p *Properties) SetValue(iface, property string, v interface{}) *dbus.Error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if _, err := p.lookup(iface, property); err != nil {
+		return err
+	}
+	c := make(changes)
+	err := p.set(iface, property, v, c)
+	p.emit(c)
+	return err
+}
+
+// lookup returns the given property. p.mut must be locked.
+func (p *Properties) lookup(iface, property string) (*Prop, *dbus.Error) {
+	m, ok := p.m[iface]
+	if !ok {
+		return nil, ErrIfaceNotFound
+	}
+	prop, ok := m[property]
+	if !ok {
+		return nil, ErrPropNotFound
+	}
+	return prop, nil
+}
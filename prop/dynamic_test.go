@@ -0,0 +1,75 @@
+package prop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestDynamicInterfaces(t *testing.T) {
+	conn := connectSessionBus(t)
+	defer conn.Close()
+	const root = "/org/guelfey/DBus/Dynamic"
+	if _, err := conn.ExportObjectManager(root); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan *dbus.Signal, 10)
+	_, err := conn.Subscribe(ch, dbus.WithMatchObjectPath(root),
+		dbus.WithMatchInterface("org.freedesktop.DBus.ObjectManager"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func(name string) *dbus.Signal {
+		select {
+		case sig := <-ch:
+			if sig.Name != name {
+				t.Fatalf("received %s, expected %s", sig.Name, name)
+			}
+			return sig
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received", name)
+		}
+		return nil
+	}
+
+	p := New(conn, root+"/a", map[string]map[string]*Prop{})
+	receive("org.freedesktop.DBus.ObjectManager.InterfacesAdded")
+
+	p.AddInterface("org.example.Battery", map[string]*Prop{"Level": {Value: uint8(3)}})
+	sig := receive("org.freedesktop.DBus.ObjectManager.InterfacesAdded")
+	var (
+		path       dbus.ObjectPath
+		interfaces map[string]map[string]dbus.Variant
+	)
+	if err := dbus.Store(sig.Body, &path, &interfaces); err != nil {
+		t.Fatal(err)
+	}
+	if path != root+"/a" || len(interfaces) != 1 || interfaces["org.example.Battery"]["Level"].Value() != uint8(3) {
+		t.Errorf("unexpected InterfacesAdded %v, %v", path, interfaces)
+	}
+
+	if err := p.AddProperty("org.example.Battery", "Model", &Prop{Value: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.GetValue("org.example.Battery", "Model"); err != nil || v != "x" {
+		t.Errorf("GetValue returned %v, %v", v, err)
+	}
+	if _, err := p.GetValue("org.example.Battery", "Missing"); err != ErrPropNotFound {
+		t.Errorf("GetValue returned %v for a missing property", err)
+	}
+	if err := p.SetValue("org.example.Missing", "Model", "y"); err != ErrIfaceNotFound {
+		t.Errorf("SetValue returned %v for a missing interface", err)
+	}
+
+	p.RemoveProperty("org.example.Battery", "Model")
+	p.RemoveProperty("org.example.Battery", "Level")
+	sig = receive("org.freedesktop.DBus.ObjectManager.InterfacesRemoved")
+	var removed []string
+	if err := dbus.Store(sig.Body, &path, &removed); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "org.example.Battery" {
+		t.Errorf("unexpected InterfacesRemoved %v", removed)
+	}
+}
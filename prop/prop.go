@@ -5,7 +5,9 @@ package prop
 import (
 	"github.com/godbus/dbus"
 	"github.com/godbus/dbus/introspect"
+	"sort"
 	"sync"
+	"time"
 )
 
 // EmitType controls how org.freedesktop.DBus.Properties.PropertiesChanged is
@@ -18,8 +20,31 @@ const (
 	EmitFalse EmitType = iota
 	EmitTrue
 	EmitInvalidates
+	// EmitConst marks a property that never changes, so the signal is never
+	// emitted.
+	EmitConst
 )
 
+// emitsChangedSignal is the annotation that describes the EmitType of a
+// property in the introspection data.
+const emitsChangedSignal = "org.freedesktop.DBus.Property.EmitsChangedSignal"
+
+// String returns the value of the EmitsChangedSignal annotation that
+// corresponds to e.
+func (e EmitType) String() string {
+	switch e {
+	case EmitFalse:
+		return "false"
+	case EmitTrue:
+		return "true"
+	case EmitInvalidates:
+		return "invalidates"
+	case EmitConst:
+		return "const"
+	}
+	return "invalid"
+}
+
 // ErrIfaceNotFound is the error returned to peers who try to access properties
 // on interfaces that aren't found.
 var ErrIfaceNotFound = dbus.NewError("org.freedesktop.DBus.Properties.Error.InterfaceNotFound", nil)
@@ -32,6 +57,10 @@ var ErrPropNotFound = dbus.NewError("org.freedesktop.DBus.Properties.Error.Prope
 // property.
 var ErrReadOnly = dbus.NewError("org.freedesktop.DBus.Properties.Error.ReadOnly", nil)
 
+// ErrWriteOnly is the error returned to peers trying to read a write-only
+// property.
+var ErrWriteOnly = dbus.NewError("org.freedesktop.DBus.Properties.Error.WriteOnly", nil)
+
 // ErrInvalidArg is returned to peers if the type of the property that is being
 // changed and the argument don't match.
 var ErrInvalidArg = dbus.NewError("org.freedesktop.DBus.Properties.Error.InvalidArg", nil)
@@ -105,7 +134,9 @@ const IntrospectDataString = `
 // Prop represents a single property. It is used for creating a Properties
 // value.
 type Prop struct {
-	// Initial value. Must be a DBus-representable type.
+	// Initial value. Must be a DBus-representable type or Computed. The
+	// properties returned by FromStruct use a Value that reads and writes
+	// the struct.
 	Value interface{}
 
 	// If true, the value can be modified by calls to Set.
@@ -122,6 +153,71 @@ type Prop struct {
 	Callback func(*Change) *dbus.Error
 }
 
+// boundValue is the Value of a property whose value isn't stored in the Prop
+// itself.
+type boundValue interface {
+	get() (interface{}, *dbus.Error)
+	set(v interface{}) *dbus.Error
+	signature() dbus.Signature
+	readable() bool
+	settable() bool
+}
+
+// get returns the current value of the property.
+func (prop *Prop) get() (interface{}, *dbus.Error) {
+	if b, ok := prop.Value.(boundValue); ok {
+		if !b.readable() {
+			return nil, ErrWriteOnly
+		}
+		return b.get()
+	}
+	return prop.Value, nil
+}
+
+// store changes the value of the property.
+func (prop *Prop) store(v interface{}) *dbus.Error {
+	if b, ok := prop.Value.(boundValue); ok {
+		return b.set(v)
+	}
+	prop.Value = v
+	return nil
+}
+
+func (prop *Prop) signature() dbus.Signature {
+	if b, ok := prop.Value.(boundValue); ok {
+		return b.signature()
+	}
+	return dbus.SignatureOf(prop.Value)
+}
+
+func (prop *Prop) readable() bool {
+	if b, ok := prop.Value.(boundValue); ok {
+		return b.readable()
+	}
+	return true
+}
+
+// settable reports whether store can change the value, regardless of
+// Writable.
+func (prop *Prop) settable() bool {
+	if b, ok := prop.Value.(boundValue); ok {
+		return b.settable()
+	}
+	return true
+}
+
+// access returns the access attribute of the introspection data.
+func (prop *Prop) access() string {
+	switch {
+	case !prop.readable():
+		return "write"
+	case prop.Writable:
+		return "readwrite"
+	default:
+		return "read"
+	}
+}
+
 // Change represents a change of a property by a call to Set.
 type Change struct {
 	Props *Properties
@@ -138,6 +234,11 @@ type Properties struct {
 	mut  sync.RWMutex
 	conn *dbus.Conn
 	path dbus.ObjectPath
+
+	// changes that are emitted when the debounce timer fires
+	debounce time.Duration
+	pending  changes
+	timer    *time.Timer
 }
 
 // New returns a new Properties structure that manages the given properties.
@@ -162,7 +263,11 @@ func (p *Properties) Get(iface, property string) (dbus.Variant, *dbus.Error) {
 	if !ok {
 		return dbus.Variant{}, ErrPropNotFound
 	}
-	return dbus.MakeVariant(prop.Value), nil
+	v, err := prop.get()
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	return dbus.MakeVariant(v), nil
 }
 
 // GetAll implements org.freedesktop.DBus.Properties.GetAll.
@@ -174,18 +279,43 @@ func (p *Properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error)
 		return nil, ErrIfaceNotFound
 	}
 	rm := make(map[string]dbus.Variant, len(m))
-	for k, v := range m {
-		rm[k] = dbus.MakeVariant(v.Value)
+	for k, prop := range m {
+		if !prop.readable() {
+			continue
+		}
+		v, err := prop.get()
+		if err != nil {
+			return nil, err
+		}
+		rm[k] = dbus.MakeVariant(v)
 	}
 	return rm, nil
 }
 
+// Interfaces returns the names of the interfaces that have properties. Together
+// with GetAll, it implements dbus.PropertyProvider.
+func (p *Properties) Interfaces() []string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	s := make([]string, 0, len(p.m))
+	for iface := range p.m {
+		s = append(s, iface)
+	}
+	sort.Strings(s)
+	return s
+}
+
 // GetMust returns the value of the given property and panics if either the
-// interface or the property name are invalid.
+// interface or the property name are invalid. See GetValue for a variant that
+// returns an error instead.
 func (p *Properties) GetMust(iface, property string) interface{} {
 	p.mut.RLock()
 	defer p.mut.RUnlock()
-	return p.m[iface][property].Value
+	v, err := p.m[iface][property].get()
+	if err != nil {
+		panic(err)
+	}
+	return v
 }
 
 // Introspection returns the introspection data that represents the properties
@@ -196,35 +326,57 @@ func (p *Properties) Introspection(iface string) []introspect.Property {
 	m := p.m[iface]
 	s := make([]introspect.Property, 0, len(m))
 	for k, v := range m {
-		p := introspect.Property{Name: k, Type: dbus.SignatureOf(v.Value).String()}
-		if v.Writable {
-			p.Access = "readwrite"
-		} else {
-			p.Access = "read"
+		p := introspect.Property{Name: k, Type: v.signature().String(), Access: v.access()}
+		if v.Emit != EmitTrue {
+			p.Annotations = []introspect.Annotation{{Name: emitsChangedSignal, Value: v.Emit.String()}}
 		}
 		s = append(s, p)
 	}
 	return s
 }
 
-// set sets the given property and emits PropertyChanged if appropiate. p.mut
-// must already be locked.
-func (p *Properties) set(iface, property string, v interface{}) {
+// IntrospectInterface implements dbus.Introspector. It returns the <property>
+// elements for iface and the PropertiesChanged signal for
+// org.freedesktop.DBus.Properties, so that they are part of the introspection
+// data generated by the connection.
+func (p *Properties) IntrospectInterface(iface string) string {
+	if iface == "org.freedesktop.DBus.Properties" {
+		return `<signal name="PropertiesChanged">
+			<arg name="interface" type="s"/>
+			<arg name="changed_properties" type="a{sv}"/>
+			<arg name="invalidates_properties" type="as"/>
+		</signal>`
+	}
+	props := p.Introspection(iface)
+	sort.Slice(props, func(i, j int) bool { return props[i].Name < props[j].Name })
+	s := ""
+	for i, v := range props {
+		if i > 0 {
+			s += "\n\t\t"
+		}
+		s += `<property name="` + v.Name + `" type="` + v.Type + `" access="` + v.Access + `"`
+		if len(v.Annotations) == 0 {
+			s += `/>`
+			continue
+		}
+		s += `>`
+		for _, a := range v.Annotations {
+			s += "\n\t\t\t" + `<annotation name="` + a.Name + `" value="` + a.Value + `"/>`
+		}
+		s += "\n\t\t</property>"
+	}
+	return s
+}
+
+// set sets the given property and records the change in c if appropiate.
+// p.mut must already be locked.
+func (p *Properties) set(iface, property string, v interface{}, c changes) *dbus.Error {
 	prop := p.m[iface][property]
-	prop.Value = v
-	switch prop.Emit {
-	case EmitFalse:
-		// do nothing
-	case EmitInvalidates:
-		p.conn.Emit(p.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
-			iface, map[string]dbus.Variant{}, []string{property})
-	case EmitTrue:
-		p.conn.Emit(p.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
-			iface, map[string]dbus.Variant{property: dbus.MakeVariant(v)},
-			[]string{})
-	default:
-		panic("invalid value for EmitType")
+	if err := prop.store(v); err != nil {
+		return err
 	}
+	c.add(iface, property, prop.Emit, v)
+	return nil
 }
 
 // Set implements org.freedesktop.Properties.Set.
@@ -242,7 +394,7 @@ func (p *Properties) Set(iface, property string, newv dbus.Variant) *dbus.Error
 	if !prop.Writable {
 		return ErrReadOnly
 	}
-	if newv.Signature() != dbus.SignatureOf(prop.Value) {
+	if newv.Signature() != prop.signature() {
 		return ErrInvalidArg
 	}
 	if prop.Callback != nil {
@@ -251,14 +403,22 @@ func (p *Properties) Set(iface, property string, newv dbus.Variant) *dbus.Error
 			return err
 		}
 	}
-	p.set(iface, property, newv.Value())
-	return nil
+	c := make(changes)
+	err := p.set(iface, property, newv.Value(), c)
+	p.emit(c)
+	return err
 }
 
 // SetMust sets the value of the given property and panics if the interface or
-// the property name are invalid.
+// the property name are invalid or a setter bound by FromStruct fails. See
+// SetValue for a variant that returns an error instead.
 func (p *Properties) SetMust(iface, property string, v interface{}) {
 	p.mut.Lock()
-	p.set(iface, property, v)
-	p.mut.Unlock()
+	defer p.mut.Unlock()
+	c := make(changes)
+	err := p.set(iface, property, v, c)
+	p.emit(c)
+	if err != nil {
+		panic(err)
+	}
 }
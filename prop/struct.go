@@ -0,0 +1,162 @@
+package prop
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+var errorType = reflect.TypeOf((*dbus.Error)(nil))
+
+// FromStruct returns the properties of an interface that are described by the
+// exported fields of the struct v points to. The returned map can be passed
+// to New as the properties of an interface.
+//
+// The property of a field is configured with a tag of the form
+//
+//	`dbus:"Name,access=readwrite,emit=invalidates"`
+//
+// where all parts are optional. Name defaults to the name of the field and a
+// tag of "-" skips the field. access is one of read (the default), readwrite
+// and write; emit is one of true (the default), false, invalidates and const
+// (see EmitType).
+//
+// Get and Set read and write the field. If *v has a method named Get<Field>
+// of the type func() (T, *dbus.Error) or Set<Field> of the type
+// func(T) *dbus.Error, where T is the type of the field, it is called
+// instead. The value written by Set must have the signature of T.
+//
+// Fields must only be changed with Properties.SetMust or while no Properties
+// uses them, as PropertiesChanged isn't emitted otherwise.
+func FromStruct(v interface{}) (map[string]*Prop, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("prop: FromStruct needs a pointer to a struct, got %T", v)
+	}
+	t := rv.Elem().Type()
+	props := make(map[string]*Prop)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("dbus")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		b := &fieldValue{field: rv.Elem().Field(i)}
+		prop := &Prop{Value: b, Emit: EmitTrue}
+		name := f.Name
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		for _, option := range parts[1:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("prop: invalid option %q for field %s", option, f.Name)
+			}
+			switch kv[0] {
+			case "access":
+				switch kv[1] {
+				case "read":
+				case "readwrite":
+					prop.Writable = true
+				case "write":
+					prop.Writable = true
+					b.writeOnly = true
+				default:
+					return nil, fmt.Errorf("prop: invalid access %q for field %s", kv[1], f.Name)
+				}
+			case "emit":
+				emit, ok := parseEmitType(kv[1])
+				if !ok {
+					return nil, fmt.Errorf("prop: invalid emit %q for field %s", kv[1], f.Name)
+				}
+				prop.Emit = emit
+			default:
+				return nil, fmt.Errorf("prop: invalid option %q for field %s", option, f.Name)
+			}
+		}
+		if err := b.bindMethods(rv, f); err != nil {
+			return nil, err
+		}
+		if _, ok := props[name]; ok {
+			return nil, fmt.Errorf("prop: duplicate property %s", name)
+		}
+		props[name] = prop
+	}
+	return props, nil
+}
+
+func parseEmitType(s string) (EmitType, bool) {
+	for _, e := range []EmitType{EmitFalse, EmitTrue, EmitInvalidates, EmitConst} {
+		if e.String() == s {
+			return e, true
+		}
+	}
+	return 0, false
+}
+
+// fieldValue binds a property to a struct field and its getter and setter
+// methods.
+type fieldValue struct {
+	field     reflect.Value
+	getter    reflect.Value
+	setter    reflect.Value
+	writeOnly bool
+}
+
+func (b *fieldValue) bindMethods(v reflect.Value, f reflect.StructField) error {
+	if m := v.MethodByName("Get" + f.Name); m.IsValid() {
+		t := m.Type()
+		if t.NumIn() != 0 || t.NumOut() != 2 || t.Out(0) != f.Type || t.Out(1) != errorType {
+			return fmt.Errorf("prop: Get%s must be of the type func() (%s, *dbus.Error)", f.Name, f.Type)
+		}
+		b.getter = m
+	}
+	if m := v.MethodByName("Set" + f.Name); m.IsValid() {
+		t := m.Type()
+		if t.NumIn() != 1 || t.NumOut() != 1 || t.In(0) != f.Type || t.Out(0) != errorType {
+			return fmt.Errorf("prop: Set%s must be of the type func(%s) *dbus.Error", f.Name, f.Type)
+		}
+		b.setter = m
+	}
+	return nil
+}
+
+func (b *fieldValue) get() (interface{}, *dbus.Error) {
+	if b.getter.IsValid() {
+		out := b.getter.Call(nil)
+		if err := out[1].Interface().(*dbus.Error); err != nil {
+			return nil, err
+		}
+		return out[0].Interface(), nil
+	}
+	return b.field.Interface(), nil
+}
+
+func (b *fieldValue) set(v interface{}) *dbus.Error {
+	ptr := reflect.New(b.field.Type())
+	if dbus.Store([]interface{}{v}, ptr.Interface()) != nil {
+		return ErrInvalidArg
+	}
+	rv := ptr.Elem()
+	if b.setter.IsValid() {
+		err, _ := b.setter.Call([]reflect.Value{rv})[0].Interface().(*dbus.Error)
+		return err
+	}
+	b.field.Set(rv)
+	return nil
+}
+
+func (b *fieldValue) signature() dbus.Signature {
+	return dbus.SignatureOfType(b.field.Type())
+}
+
+func (b *fieldValue) readable() bool {
+	return !b.writeOnly
+}
+
+func (b *fieldValue) settable() bool {
+	return true
+}
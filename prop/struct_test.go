@@ -0,0 +1,77 @@
+package prop
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+type battery struct {
+	Level    float64 `dbus:",emit=false"`
+	Name     string  `dbus:"Model,access=readwrite,emit=false"`
+	Secret   string  `dbus:",access=write,emit=false"`
+	Serial   string  `dbus:",emit=const"`
+	Ignored  int32   `dbus:"-"`
+	unexport int32
+
+	setCalls int
+}
+
+func (b *battery) SetName(name string) *dbus.Error {
+	b.setCalls++
+	b.Name = name
+	return nil
+}
+
+func TestFromStruct(t *testing.T) {
+	b := &battery{Level: 0.5, Name: "foo", Serial: "123"}
+	props, err := FromStruct(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props) != 4 || props["Model"] == nil || props["Serial"].Emit != EmitConst {
+		t.Fatalf("unexpected properties %v", props)
+	}
+	p := &Properties{m: map[string]map[string]*Prop{"org.example.Battery": props}}
+
+	v, derr := p.Get("org.example.Battery", "Level")
+	if derr != nil || v.Value() != 0.5 {
+		t.Errorf("Get returned %v, %v", v, derr)
+	}
+	if _, err := p.Get("org.example.Battery", "Secret"); err != ErrWriteOnly {
+		t.Errorf("Get of a write-only property returned %v", err)
+	}
+	all, derr := p.GetAll("org.example.Battery")
+	if derr != nil || len(all) != 3 {
+		t.Errorf("GetAll returned %v, %v", all, derr)
+	}
+
+	if err := p.Set("org.example.Battery", "Model", dbus.MakeVariant("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "bar" || b.setCalls != 1 {
+		t.Errorf("setter not called: %q, %d", b.Name, b.setCalls)
+	}
+	if err := p.Set("org.example.Battery", "Level", dbus.MakeVariant(1.0)); err != ErrReadOnly {
+		t.Errorf("Set of a read-only property returned %v", err)
+	}
+	if err := p.Set("org.example.Battery", "Model", dbus.MakeVariant(int32(1))); err != ErrInvalidArg {
+		t.Errorf("Set with a wrong type returned %v", err)
+	}
+
+	for _, v := range p.Introspection("org.example.Battery") {
+		if v.Name == "Secret" && v.Access != "write" {
+			t.Errorf("unexpected access %s for Secret", v.Access)
+		}
+	}
+
+	if _, err := FromStruct(struct{ A int32 }{}); err == nil {
+		t.Error("FromStruct accepted a struct value")
+	}
+	type invalid struct {
+		A int32 `dbus:",access=none"`
+	}
+	if _, err := FromStruct(&invalid{}); err == nil {
+		t.Error("FromStruct accepted an invalid access")
+	}
+}
@@ -0,0 +1,176 @@
+package prop
+
+import (
+	"sort"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// changes collects the changes of properties that are announced with
+// PropertiesChanged, by interface.
+type changes map[string]*ifaceChanges
+
+type ifaceChanges struct {
+	changed     map[string]dbus.Variant
+	invalidated []string
+}
+
+// add records that property was set to v.
+func (c changes) add(iface, property string, emit EmitType, v interface{}) {
+	switch emit {
+	case EmitFalse, EmitConst:
+		return
+	case EmitTrue, EmitInvalidates:
+	default:
+		panic("invalid value for EmitType")
+	}
+	ic, ok := c[iface]
+	if !ok {
+		ic = &ifaceChanges{changed: make(map[string]dbus.Variant), invalidated: []string{}}
+		c[iface] = ic
+	}
+	if emit == EmitTrue {
+		ic.changed[property] = dbus.MakeVariant(v)
+		return
+	}
+	for _, name := range ic.invalidated {
+		if name == property {
+			return
+		}
+	}
+	ic.invalidated = append(ic.invalidated, property)
+}
+
+// merge adds the changes of other to c. Later values replace earlier ones.
+func (c changes) merge(other changes) {
+	for iface, oc := range other {
+		ic, ok := c[iface]
+		if !ok {
+			c[iface] = oc
+			continue
+		}
+		for name, v := range oc.changed {
+			ic.changed[name] = v
+		}
+		for _, name := range oc.invalidated {
+			c.add(iface, name, EmitInvalidates, nil)
+		}
+	}
+}
+
+// emit emits PropertiesChanged for c, or queues it if a debounce window is
+// set. p.mut must be locked.
+func (p *Properties) emit(c changes) {
+	if len(c) == 0 {
+		return
+	}
+	if p.debounce <= 0 {
+		p.emitNow(c)
+		return
+	}
+	if p.pending == nil {
+		p.pending = make(changes)
+	}
+	p.pending.merge(c)
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.debounce, p.flush)
+	}
+}
+
+// emitNow emits one PropertiesChanged signal per interface of c. p.mut must be
+// locked.
+func (p *Properties) emitNow(c changes) {
+	ifaces := make([]string, 0, len(c))
+	for iface := range c {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	for _, iface := range ifaces {
+		p.conn.Emit(p.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+			iface, c[iface].changed, c[iface].invalidated)
+	}
+}
+
+func (p *Properties) flush() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.timer = nil
+	pending := p.pending
+	p.pending = nil
+	p.emitNow(pending)
+}
+
+// SetDebounce sets a window in which changes are collected before
+// PropertiesChanged is emitted for them. Then, a single signal per interface
+// is emitted that contains the last value of every changed property. By
+// default (or if d is 0), the signal is emitted immediately. Changes that are
+// pending when SetDebounce is called are emitted.
+func (p *Properties) SetDebounce(d time.Duration) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.debounce = d
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+		pending := p.pending
+		p.pending = nil
+		p.emitNow(pending)
+	}
+}
+
+// Transaction collects changes of properties that are applied together by
+// Commit. It is created by Begin.
+type Transaction struct {
+	p    *Properties
+	sets []propertySet
+}
+
+type propertySet struct {
+	iface, property string
+	value           interface{}
+}
+
+// Begin starts a transaction. Unlike with SetMust, the changes are only made
+// by Commit and announced with a single PropertiesChanged signal per
+// interface.
+func (p *Properties) Begin() *Transaction {
+	return &Transaction{p: p}
+}
+
+// Set records that the given property is set to v on Commit. As with SetMust,
+// the property doesn't need to be writable and no callback is called.
+func (t *Transaction) Set(iface, property string, v interface{}) {
+	t.sets = append(t.sets, propertySet{iface, property, v})
+}
+
+// Commit makes the changes of the transaction in the order in which they were
+// recorded and emits PropertiesChanged for them. If a property doesn't exist
+// or can't be changed, no changes are made and the error is returned. If a
+// setter (e.g. one bound by FromStruct) fails, the remaining changes are not
+// made and the error is returned; the ones made before are emitted. The
+// transaction is empty afterwards.
+func (t *Transaction) Commit() *dbus.Error {
+	p := t.p
+	sets := t.sets
+	t.sets = nil
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for _, s := range sets {
+		prop, err := p.lookup(s.iface, s.property)
+		if err != nil {
+			return err
+		}
+		if !prop.settable() {
+			return ErrReadOnly
+		}
+	}
+	c := make(changes)
+	defer p.emit(c)
+	for _, s := range sets {
+		if err := p.set(s.iface, s.property, s.value, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
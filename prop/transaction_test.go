@@ -0,0 +1,114 @@
+package prop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func connectSessionBus(t *testing.T) *dbus.Conn {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestTransaction(t *testing.T) {
+	conn := connectSessionBus(t)
+	defer conn.Close()
+	const path = "/org/guelfey/DBus/Transaction"
+	ch := make(chan *dbus.Signal, 10)
+	_, err := conn.Subscribe(ch, dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"), dbus.WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(conn, path, map[string]map[string]*Prop{
+		"org.example.A": {
+			"X": {Value: int32(0), Emit: EmitTrue},
+			"Y": {Value: int32(0), Emit: EmitInvalidates},
+		},
+		"org.example.B": {
+			"Z": {Value: "", Emit: EmitTrue},
+		},
+	})
+	tx := p.Begin()
+	tx.Set("org.example.A", "X", int32(1))
+	tx.Set("org.example.A", "Y", int32(1))
+	tx.Set("org.example.A", "X", int32(2))
+	tx.Set("org.example.B", "Z", "z")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetMust("org.example.A", "X") != int32(2) {
+		t.Errorf("X is %v after Commit", p.GetMust("org.example.A", "X"))
+	}
+
+	var (
+		iface       string
+		changed     map[string]dbus.Variant
+		invalidated []string
+	)
+	for _, expected := range []string{"org.example.A", "org.example.B"} {
+		changed, invalidated = nil, nil
+		select {
+		case sig := <-ch:
+			if err := dbus.Store(sig.Body, &iface, &changed, &invalidated); err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("PropertiesChanged not received")
+		}
+		if iface != expected {
+			t.Fatalf("PropertiesChanged for %s, expected %s", iface, expected)
+		}
+	}
+	// the last signal is for org.example.B
+	if len(changed) != 1 || changed["Z"].Value() != "z" || len(invalidated) != 0 {
+		t.Errorf("unexpected changes %v, %v", changed, invalidated)
+	}
+
+	// nothing is changed or emitted if a property is missing
+	tx = p.Begin()
+	tx.Set("org.example.A", "X", int32(3))
+	tx.Set("org.example.A", "Missing", int32(1))
+	if err := tx.Commit(); err != ErrPropNotFound {
+		t.Errorf("Commit returned %v for a missing property", err)
+	}
+	if p.GetMust("org.example.A", "X") != int32(2) {
+		t.Errorf("X is %v after a failed Commit", p.GetMust("org.example.A", "X"))
+	}
+
+	p.SetDebounce(50 * time.Millisecond)
+	for i := int32(0); i < 5; i++ {
+		p.SetMust("org.example.A", "X", i)
+	}
+	changed, invalidated = nil, nil
+	select {
+	case sig := <-ch:
+		if err := dbus.Store(sig.Body, &iface, &changed, &invalidated); err != nil {
+			t.Fatal(err)
+		}
+		if len(changed) != 1 || changed["X"].Value() != int32(4) {
+			t.Errorf("unexpected changes %v", changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PropertiesChanged not received")
+	}
+	select {
+	case sig := <-ch:
+		t.Errorf("unexpected signal %v", sig)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,307 @@
+package dbus
+
+import (
+	"context"
+	"sync"
+)
+
+const propertiesIface = "org.freedesktop.DBus.Properties"
+
+// PropertiesChange describes a change of the properties of an interface that
+// is cached by a PropertiesProxy.
+type PropertiesChange struct {
+	Interface   string
+	Changed     map[string]Variant
+	Invalidated []string
+}
+
+// PropertiesProxy gives access to the properties of a remote object through
+// the org.freedesktop.DBus.Properties interface. The properties of an
+// interface can be cached with Cache; the cache is then kept up to date with
+// the PropertiesChanged signal. It is safe for concurrent use by multiple
+// goroutines.
+type PropertiesProxy struct {
+	conn *Conn
+	obj  BusObject
+
+	mu     sync.RWMutex
+	cache  map[string]*propertyCache
+	notify []chan<- PropertiesChange
+	sub    *Subscription
+	done   chan struct{}
+	// stale wakes up the goroutine that fetches invalidated properties
+	stale chan struct{}
+}
+
+// propertyCache holds the cached properties of an interface. Changes that
+// arrive while it is loaded are kept in pending and applied afterwards.
+// Invalidated properties are removed and fetched again by the goroutine
+// started by subscribe, which loads the whole interface if stale is set.
+type propertyCache struct {
+	props   map[string]Variant
+	loading bool
+	stale   bool
+	pending []PropertiesChange
+}
+
+// apply applies change to c. p.mu must be locked.
+func (c *propertyCache) apply(change PropertiesChange) {
+	for name, v := range change.Changed {
+		c.props[name] = v
+	}
+	for _, name := range change.Invalidated {
+		delete(c.props, name)
+		c.stale = true
+	}
+}
+
+// NewPropertiesProxy returns a PropertiesProxy for obj, which must be an
+// object of conn.
+func NewPropertiesProxy(conn *Conn, obj BusObject) *PropertiesProxy {
+	return &PropertiesProxy{
+		conn:  conn,
+		obj:   obj,
+		cache: make(map[string]*propertyCache),
+	}
+}
+
+// Get returns the value of a property. The cached value is returned if iface
+// is cached.
+func (p *PropertiesProxy) Get(ctx context.Context, iface, name string) (Variant, error) {
+	p.mu.RLock()
+	if c, ok := p.cache[iface]; ok && !c.loading {
+		v, ok := c.props[name]
+		p.mu.RUnlock()
+		if ok {
+			return v, nil
+		}
+	} else {
+		p.mu.RUnlock()
+	}
+	var v Variant
+	err := p.obj.CallWithContext(ctx, propertiesIface+".Get", 0, iface, name).Store(&v)
+	return v, err
+}
+
+// Store stores the value of a property in v, which must be a pointer, with
+// the same conversions that Store does.
+func (p *PropertiesProxy) Store(ctx context.Context, iface, name string, v interface{}) error {
+	value, err := p.Get(ctx, iface, name)
+	if err != nil {
+		return err
+	}
+	return Store([]interface{}{value.Value()}, v)
+}
+
+// GetAll returns the values of all properties of iface. The cached values
+// are returned if iface is cached.
+func (p *PropertiesProxy) GetAll(ctx context.Context, iface string) (map[string]Variant, error) {
+	p.mu.RLock()
+	if c, ok := p.cache[iface]; ok && !c.loading {
+		props := make(map[string]Variant, len(c.props))
+		for name, v := range c.props {
+			props[name] = v
+		}
+		p.mu.RUnlock()
+		return props, nil
+	}
+	p.mu.RUnlock()
+	var props map[string]Variant
+	err := p.obj.CallWithContext(ctx, propertiesIface+".GetAll", 0, iface).Store(&props)
+	return props, err
+}
+
+// Set sets the value of a property. If value is not a Variant, it is
+// converted to one with MakeVariant.
+func (p *PropertiesProxy) Set(ctx context.Context, iface, name string, value interface{}) error {
+	v, ok := value.(Variant)
+	if !ok {
+		v = MakeVariant(value)
+	}
+	return p.obj.CallWithContext(ctx, propertiesIface+".Set", 0, iface, name, v).Err
+}
+
+// Cache loads all properties of iface with GetAll and keeps them up to date
+// with the PropertiesChanged signal. Invalidated properties are fetched
+// again in the background, with a single GetAll for all of them; until then,
+// Get calls the remote object for them.
+func (p *PropertiesProxy) Cache(ctx context.Context, iface string) error {
+	if err := p.subscribe(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if _, ok := p.cache[iface]; ok {
+		p.mu.Unlock()
+		return nil
+	}
+	c := &propertyCache{loading: true}
+	p.cache[iface] = c
+	p.mu.Unlock()
+
+	if err := p.load(ctx, iface, c); err != nil {
+		p.mu.Lock()
+		if p.cache[iface] == c {
+			delete(p.cache, iface)
+		}
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// load loads the properties of iface into c, which must be loading, with
+// GetAll. If it fails, the properties cached before are kept.
+func (p *PropertiesProxy) load(ctx context.Context, iface string, c *propertyCache) error {
+	var props map[string]Variant
+	err := p.obj.CallWithContext(ctx, propertiesIface+".GetAll", 0, iface).Store(&props)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.loading = false
+	pending := c.pending
+	c.pending = nil
+	if err == nil {
+		if props == nil {
+			props = make(map[string]Variant)
+		}
+		c.props = props
+	} else if c.props == nil {
+		return err
+	}
+	// the changes that arrived during the call may be older than the reply;
+	// applying them again doesn't change the result, as every change
+	// overwrites the previous state, but invalidated properties are fetched
+	// once more.
+	for _, change := range pending {
+		c.apply(change)
+	}
+	if c.stale {
+		p.wakeRefresh()
+	}
+	return err
+}
+
+// Notify registers ch to receive the changes of the cached properties. If ch
+// is full when a change is sent, it is discarded.
+func (p *PropertiesProxy) Notify(ch chan<- PropertiesChange) {
+	p.mu.Lock()
+	p.notify = append(p.notify, ch)
+	p.mu.Unlock()
+}
+
+// Close stops updating the cache and removes the match rule for
+// PropertiesChanged. The cached values are discarded.
+func (p *PropertiesProxy) Close() error {
+	p.mu.Lock()
+	sub, done := p.sub, p.done
+	p.sub = nil
+	p.cache = make(map[string]*propertyCache)
+	p.mu.Unlock()
+	if sub == nil {
+		return nil
+	}
+	err := sub.Unsubscribe()
+	close(done)
+	return err
+}
+
+// subscribe subscribes to PropertiesChanged if that wasn't done yet.
+func (p *PropertiesProxy) subscribe() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sub != nil {
+		return nil
+	}
+	ch := make(chan *Signal, defaultSignalQueueSize)
+	sub, err := p.conn.Subscribe(ch,
+		WithMatchSender(p.obj.Destination()),
+		WithMatchObjectPath(p.obj.Path()),
+		WithMatchInterface(propertiesIface),
+		WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		return err
+	}
+	// run never blocks, so no signal needs to be dropped
+	p.conn.SetSignalQueue(ch, defaultSignalQueueSize, OverflowBlock)
+	p.sub = sub
+	p.done = make(chan struct{})
+	p.stale = make(chan struct{}, 1)
+	go p.run(ch, p.done)
+	go p.refresh(p.stale, p.done)
+	return nil
+}
+
+func (p *PropertiesProxy) run(ch <-chan *Signal, done <-chan struct{}) {
+	for {
+		select {
+		case sig, ok := <-ch:
+			if !ok {
+				return
+			}
+			p.handleSignal(sig)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (p *PropertiesProxy) handleSignal(sig *Signal) {
+	var change PropertiesChange
+	if Store(sig.Body, &change.Interface, &change.Changed, &change.Invalidated) != nil {
+		return
+	}
+	p.mu.Lock()
+	c, ok := p.cache[change.Interface]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	if c.loading {
+		c.pending = append(c.pending, change)
+	} else {
+		c.apply(change)
+		if c.stale {
+			p.wakeRefresh()
+		}
+	}
+	notify := p.notify
+	p.mu.Unlock()
+
+	for _, ch := range notify {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// wakeRefresh wakes up refresh. p.mu must be locked.
+func (p *PropertiesProxy) wakeRefresh() {
+	select {
+	case p.stale <- struct{}{}:
+	default:
+	}
+}
+
+// refresh loads the interfaces with invalidated properties again whenever it
+// is woken up by wakeRefresh.
+func (p *PropertiesProxy) refresh(stale <-chan struct{}, done <-chan struct{}) {
+	for {
+		select {
+		case <-stale:
+		case <-done:
+			return
+		}
+		p.mu.Lock()
+		caches := make(map[string]*propertyCache)
+		for iface, c := range p.cache {
+			if c.stale && !c.loading {
+				c.stale, c.loading = false, true
+				caches[iface] = c
+			}
+		}
+		p.mu.Unlock()
+		for iface, c := range caches {
+			p.load(context.Background(), iface, c)
+		}
+	}
+}
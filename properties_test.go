@@ -0,0 +1,108 @@
+package dbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type settableProperties struct {
+	testProperties
+}
+
+func (p settableProperties) Set(iface, name string, v Variant) *Error {
+	p.testProperties[iface][name] = v
+	return nil
+}
+
+func TestPropertiesProxy(t *testing.T) {
+	server := connectSessionBus(t)
+	defer server.Close()
+	client := connectSessionBus(t)
+	defer client.Close()
+
+	const (
+		path  = "/org/guelfey/DBus/Properties"
+		iface = "org.guelfey.DBus.Props"
+	)
+	props := settableProperties{testProperties{iface: {
+		"Count": MakeVariant(uint32(3)),
+		"Name":  MakeVariant("foo"),
+	}}}
+	server.Export(props, path, "org.freedesktop.DBus.Properties")
+
+	p := NewPropertiesProxy(client, client.Object(server.Names()[0], path))
+	defer p.Close()
+	ctx := context.Background()
+
+	var count uint32
+	if err := p.Store(ctx, iface, "Count", &count); err != nil || count != 3 {
+		t.Fatalf("Store returned %d, %v", count, err)
+	}
+	if err := p.Set(ctx, iface, "Count", uint32(5)); err != nil {
+		t.Fatal(err)
+	}
+	all, err := p.GetAll(ctx, iface)
+	if err != nil || len(all) != 2 || all["Count"].Value() != uint32(5) {
+		t.Fatalf("GetAll returned %v, %v", all, err)
+	}
+
+	if err := p.Cache(ctx, iface); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan PropertiesChange, 10)
+	p.Notify(changes)
+
+	// the cache is used for Get, so changes are only seen with
+	// PropertiesChanged.
+	props.testProperties[iface]["Name"] = MakeVariant("bar")
+	server.Emit(path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		iface, map[string]Variant{"Count": MakeVariant(uint32(6))}, []string{})
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not received")
+	}
+	if v, err := p.Get(ctx, iface, "Count"); err != nil || v.Value() != uint32(6) {
+		t.Errorf("Get returned %v, %v after PropertiesChanged", v, err)
+	}
+	if v, err := p.Get(ctx, iface, "Name"); err != nil || v.Value() != "foo" {
+		t.Errorf("Get returned %v, %v for a cached property", v, err)
+	}
+
+	server.Emit(path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		iface, map[string]Variant{}, []string{"Name"})
+	select {
+	case change := <-changes:
+		if len(change.Invalidated) != 1 || change.Invalidated[0] != "Name" {
+			t.Errorf("unexpected change %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not received")
+	}
+	if v, err := p.Get(ctx, iface, "Name"); err != nil || v.Value() != "bar" {
+		t.Errorf("Get returned %v, %v for an invalidated property", v, err)
+	}
+
+	// the invalidated property is cached again in the background
+	for i := 0; ; i++ {
+		p.mu.RLock()
+		c := p.cache[iface]
+		v, ok := c.props["Name"]
+		refreshed := ok && !c.loading && !c.stale
+		p.mu.RUnlock()
+		if refreshed {
+			if v.Value() != "bar" {
+				t.Errorf("cached %v for an invalidated property", v)
+			}
+			break
+		}
+		if i == 100 {
+			t.Fatal("invalidated property not cached again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if q := client.signalHandler.(*defaultSignalHandler).queue(p.sub.ch); q.policy != OverflowBlock {
+		t.Errorf("signals are queued with policy %v", q.policy)
+	}
+}
@@ -0,0 +1,280 @@
+package dbus
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	reconnectMinDelay = 100 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// reconnector holds the state of the automatic reconnection of a connection.
+type reconnector struct {
+	lck     sync.Mutex
+	enabled bool
+	stopped bool
+	done    chan struct{}
+	chans   []chan<- string
+}
+
+func newReconnector() *reconnector {
+	return &reconnector{done: make(chan struct{})}
+}
+
+func (r *reconnector) stop() {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.done)
+	}
+}
+
+func (r *reconnector) notify(name string) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	for _, ch := range r.chans {
+		select {
+		case ch <- name:
+		default:
+		}
+	}
+}
+
+// EnableReconnect causes conn to re-establish the connection to the bus if it
+// is lost. The new connection is authenticated with the same mechanisms as
+// the original one, the names that were requested with RequestName are
+// requested again and the match rules that were added with AddMatch are
+// added again. Exported objects and the channels passed to Signal stay
+// registered.
+//
+// Calls that are pending when the connection is lost, or that are made before
+// it is re-established, return an error.
+//
+// If ch is not nil, the new unique name is sent to it after each
+// reconnection. The caller has to make sure that ch is sufficiently
+// buffered; if a name can't be sent, it is discarded. EnableReconnect may be
+// called multiple times (also on shared connections) to register multiple
+// channels.
+//
+// Reconnecting is only possible for connections that were created by Dial or
+// one of the functions that use it and that were authenticated with Auth.
+func (conn *Conn) EnableReconnect(ch chan<- string) error {
+	if conn.address == "" || conn.authMethods == nil {
+		return errors.New("dbus: connection can't be re-established")
+	}
+	r := conn.reconnect
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	r.enabled = true
+	if ch != nil {
+		r.chans = append(r.chans, ch)
+	}
+	return nil
+}
+
+// reconnecting returns whether conn should be re-established after an error.
+func (conn *Conn) reconnecting() bool {
+	r := conn.reconnect
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	return r.enabled && !r.stopped
+}
+
+// redial re-establishes the connection to the bus, retrying until it succeeds
+// or conn is closed. On success, a new inWorker is started and the state of
+// the old connection is restored.
+func (conn *Conn) redial() {
+	delay := reconnectMinDelay
+	for {
+		tr, err := getTransport(conn.address)
+		if err == nil {
+			tmp := &Conn{transport: tr}
+			if err = tmp.auth(conn.authMethods); err == nil {
+				if conn.replaceTransport(tr, tmp.unixFD) {
+					conn.restore()
+				}
+				return
+			}
+			tr.Close()
+		}
+		select {
+		case <-conn.reconnect.done:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// replaceTransport replaces the transport of conn by tr and starts reading
+// from it. It returns false if conn was closed in the meantime.
+func (conn *Conn) replaceTransport(tr transport, unixFD bool) bool {
+	h := conn.outHandler
+	h.closed.lck.RLock()
+	defer h.closed.lck.RUnlock()
+	if h.closed.isClosed {
+		tr.Close()
+		return false
+	}
+	h.sendLck.Lock()
+	conn.trLck.Lock()
+	old := conn.transport
+	conn.transport = tr
+	conn.unixFD = unixFD
+	conn.trLck.Unlock()
+	h.sendLck.Unlock()
+	old.Close()
+	conn.names.reset()
+	go conn.inWorker()
+	return true
+}
+
+// restore calls Hello on a re-established connection and requests the names
+// and adds the match rules of the previous connection.
+func (conn *Conn) restore() {
+	if err := conn.Hello(); err != nil {
+		// the new connection failed, too; inWorker handles this
+		return
+	}
+	names, matches := conn.busState.reset()
+	for rule, n := range matches {
+		for i := 0; i < n; i++ {
+			conn.busObj.Call("org.freedesktop.DBus.AddMatch", 0, rule)
+		}
+	}
+	for name, flags := range names {
+		conn.RequestName(name, flags)
+	}
+	conn.reconnect.notify(conn.names.listKnownNames()[0])
+}
+
+// busState tracks the names requested and the match rules added by a
+// connection so that they can be restored after reconnecting. Calls are only
+// recorded once the bus has replied to them successfully.
+type busState struct {
+	lck     sync.Mutex
+	names   map[string]RequestNameFlags
+	matches map[string]int
+	pending map[uint32]*Message
+}
+
+func newBusState() *busState {
+	return &busState{
+		names:   make(map[string]RequestNameFlags),
+		matches: make(map[string]int),
+		pending: make(map[uint32]*Message),
+	}
+}
+
+// track remembers msg until its reply arrives if it is a call to
+// RequestName, ReleaseName, AddMatch or RemoveMatch. Calls that don't expect
+// a reply are not tracked, as their outcome is unknown.
+func (s *busState) track(msg *Message) {
+	if msg.Type != TypeMethodCall || msg.Flags&FlagNoReplyExpected != 0 || len(msg.Body) == 0 {
+		return
+	}
+	dest, _ := msg.Headers[FieldDestination].value.(string)
+	iface, _ := msg.Headers[FieldInterface].value.(string)
+	if dest != "org.freedesktop.DBus" || iface != "org.freedesktop.DBus" {
+		return
+	}
+	if _, ok := msg.Body[0].(string); !ok {
+		return
+	}
+	switch member, _ := msg.Headers[FieldMember].value.(string); member {
+	case "RequestName", "ReleaseName", "AddMatch", "RemoveMatch":
+		s.lck.Lock()
+		s.pending[msg.serial] = msg
+		s.lck.Unlock()
+	}
+}
+
+// forget stops tracking the call with the given serial, e.g. because it
+// couldn't be sent.
+func (s *busState) forget(serial uint32) {
+	s.lck.Lock()
+	delete(s.pending, serial)
+	s.lck.Unlock()
+}
+
+// forgetAll stops tracking all calls whose replies haven't arrived yet.
+func (s *busState) forgetAll() {
+	s.lck.Lock()
+	s.pending = make(map[uint32]*Message)
+	s.lck.Unlock()
+}
+
+// handleReply records the effect of the tracked call that msg replies to.
+// Errors and RequestName calls that didn't get the name or a place in its
+// queue leave the state unchanged.
+func (s *busState) handleReply(msg *Message) {
+	serial, ok := msg.Headers[FieldReplySerial].value.(uint32)
+	if !ok {
+		return
+	}
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	call, ok := s.pending[serial]
+	if !ok {
+		return
+	}
+	delete(s.pending, serial)
+	if msg.Type != TypeMethodReply {
+		return
+	}
+	member, _ := call.Headers[FieldMember].value.(string)
+	arg := call.Body[0].(string)
+	switch member {
+	case "RequestName":
+		if len(msg.Body) == 0 {
+			return
+		}
+		if r, ok := msg.Body[0].(uint32); !ok || RequestNameReply(r) == RequestNameReplyExists {
+			return
+		}
+		var flags RequestNameFlags
+		if len(call.Body) > 1 {
+			switch f := call.Body[1].(type) {
+			case RequestNameFlags:
+				flags = f
+			case uint32:
+				flags = RequestNameFlags(f)
+			}
+		}
+		s.names[arg] = flags
+	case "ReleaseName":
+		delete(s.names, arg)
+	case "AddMatch":
+		s.matches[arg]++
+	case "RemoveMatch":
+		if s.matches[arg] > 1 {
+			s.matches[arg]--
+		} else {
+			delete(s.matches, arg)
+		}
+	}
+}
+
+// nameLost drops name after the bus took it away from the connection.
+func (s *busState) nameLost(name string) {
+	s.lck.Lock()
+	delete(s.names, name)
+	s.lck.Unlock()
+}
+
+// reset clears the tracked state and returns it.
+func (s *busState) reset() (map[string]RequestNameFlags, map[string]int) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	names, matches := s.names, s.matches
+	s.names = make(map[string]RequestNameFlags)
+	s.matches = make(map[string]int)
+	return names, matches
+}
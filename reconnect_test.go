@@ -0,0 +1,211 @@
+package dbus_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/bus"
+)
+
+func dialBus(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-reconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	address := "unix:path=" + filepath.Join(dir, "socket")
+
+	b := bus.New()
+	if _, err = b.Listen(address); err != nil {
+		t.Fatal(err)
+	}
+	conn := dialBus(t, address)
+	defer conn.Close()
+	names := make(chan string, 1)
+	if err = conn.EnableReconnect(names); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.RequestName("org.guelfey.DBus.Reconnect", 0); err != nil {
+		t.Fatal(err)
+	}
+	rule := "type='signal',interface='org.guelfey.DBus.Test'"
+	if err = conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err; err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+
+	// replace the bus by a new one
+	b.Close()
+	b = bus.New()
+	defer b.Close()
+	if _, err = b.Listen(address); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	select {
+	case name = <-names:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection not re-established")
+	}
+	if conn.Names()[0] != name {
+		t.Errorf("unique name is %q, expected %q", conn.Names()[0], name)
+	}
+
+	other := dialBus(t, address)
+	defer other.Close()
+	var owner string
+	err = other.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, "org.guelfey.DBus.Reconnect").Store(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != name {
+		t.Errorf("name is owned by %q, expected %q", owner, name)
+	}
+	if err = other.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Ping"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Name == "org.guelfey.DBus.Test.Ping" {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not received after reconnecting")
+		}
+	}
+}
+
+func TestReconnectRestoresOwnedNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-reconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	address := "unix:path=" + filepath.Join(dir, "socket")
+
+	b := bus.New()
+	if _, err = b.Listen(address); err != nil {
+		t.Fatal(err)
+	}
+	conn := dialBus(t, address)
+	defer conn.Close()
+	other := dialBus(t, address)
+	names := make(chan string, 1)
+	if err = conn.EnableReconnect(names); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		kept     = "org.guelfey.DBus.Kept"
+		taken    = "org.guelfey.DBus.Taken"
+		replaced = "org.guelfey.DBus.Replaced"
+	)
+	if _, err = conn.RequestName(kept, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.RequestName(taken, 0); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(taken, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyExists {
+		t.Fatalf("got reply %d for a taken name, expected %d", reply, dbus.RequestNameReplyExists)
+	}
+	if _, err = conn.RequestName(replaced, dbus.NameFlagAllowReplacement); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.RequestName(replaced, dbus.NameFlagReplaceExisting); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ownsName(conn, replaced) {
+		if time.Now().After(deadline) {
+			t.Fatal("NameLost not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, "invalid").Err; err == nil {
+		t.Fatal("invalid match rule accepted")
+	}
+
+	// replace the bus by a new one
+	other.Close()
+	b.Close()
+	b = bus.New()
+	defer b.Close()
+	if _, err = b.Listen(address); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	select {
+	case name = <-names:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection not re-established")
+	}
+	other = dialBus(t, address)
+	defer other.Close()
+	var owner string
+	err = other.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, kept).Store(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != name {
+		t.Errorf("%s is owned by %q, expected %q", kept, owner, name)
+	}
+	for _, n := range []string{taken, replaced} {
+		if err = other.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, n).Store(&owner); err == nil {
+			t.Errorf("%s was requested again and is owned by %q", n, owner)
+		}
+	}
+}
+
+func ownsName(conn *dbus.Conn, name string) bool {
+	for _, n := range conn.Names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconnectNotPossible(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	conn, err := dbus.NewConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.EnableReconnect(nil); err == nil {
+		t.Error("EnableReconnect succeeded for a connection without address")
+	}
+}
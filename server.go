@@ -0,0 +1,453 @@
+package dbus
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is the error returned by Accept after the server has been
+// closed.
+var ErrServerClosed = errors.New("dbus: server closed")
+
+// serverAuthTimeout is the time a peer has to complete the authentication
+// protocol before it is disconnected.
+const serverAuthTimeout = 30 * time.Second
+
+// maxAuthLineLength limits the length of a line in the authentication
+// protocol that is accepted from a peer.
+const maxAuthLineLength = 16384
+
+// PeerCredentials holds the credentials of the process at the other end of a
+// connection, as reported by the operating system.
+type PeerCredentials struct {
+	Pid uint32
+	Uid uint32
+	Gid uint32
+}
+
+// ServerAuth defines the behaviour of the server side of an authentication
+// mechanism.
+type ServerAuth interface {
+	// Return the name of the mechanism.
+	Name() []byte
+
+	// Start a new authentication exchange with a peer. creds holds the
+	// credentials of the peer if the transport is able to determine them and
+	// is nil otherwise.
+	Start(creds *PeerCredentials) ServerAuthHandler
+}
+
+// ServerAuthHandler handles a single authentication exchange that was started
+// by ServerAuth.Start.
+type ServerAuthHandler interface {
+	// Process the given (already hex-decoded) data of the AUTH or DATA command
+	// and return the challenge for the next DATA command and the next status.
+	// AuthOk accepts the peer, AuthContinue sends the challenge and waits for
+	// more data and AuthError rejects the peer.
+	HandleData(data []byte) (challenge []byte, status AuthStatus)
+}
+
+// listener is the server side of a D-Bus transport.
+type listener interface {
+	// Wait for and return the next connection.
+	Accept() (transport, error)
+
+	// Stop listening.
+	Close() error
+
+	// Return the address under which the listener can be reached, without
+	// the guid.
+	Address() string
+}
+
+var (
+	listeners = make(map[string]func(string) (listener, error))
+)
+
+// authenticatedTransport is a transport on which the server side of the
+// authentication protocol was completed successfully.
+type authenticatedTransport struct {
+	transport
+	unixFD bool
+	creds  *PeerCredentials
+}
+
+// Server listens for peer-to-peer D-Bus connections (i.e. connections that
+// don't involve a message bus) and authenticates them.
+//
+// The connections returned by Accept can be used with Export, Emit and Object
+// like any other connection. Since there is no message bus, Hello must not be
+// called on them and the destination of method calls is ignored by the peer.
+type Server struct {
+	listener listener
+	guid     string
+	methods  []ServerAuth
+
+	conns    chan *authenticatedTransport
+	done     chan struct{}
+	closeLck sync.Mutex
+	closed   bool
+	err      error
+}
+
+// Listen announces on the given address and returns a Server which accepts
+// connections on it, using the EXTERNAL and DBUS_COOKIE_SHA1 mechanisms for
+// the current user. Supported addresses are unix:path=..., unix:abstract=...
+// and tcp:host=...,port=... .
+func Listen(address string) (*Server, error) {
+	return ListenAuth(address, nil)
+}
+
+// ListenAuth works like Listen, but offers the given list of authentication
+// mechanisms (in that order) to peers. If nil is passed, the EXTERNAL and
+// DBUS_COOKIE_SHA1 mechanisms are used for the current user.
+func ListenAuth(address string, methods []ServerAuth) (*Server, error) {
+	if methods == nil {
+		methods = []ServerAuth{ServerAuthExternal(), ServerAuthCookieSha1(getHomeDir())}
+	}
+	l, err := getListener(address)
+	if err != nil {
+		return nil, err
+	}
+	guid, err := newGUID()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		guid:     guid,
+		methods:  methods,
+		conns:    make(chan *authenticatedTransport),
+		done:     make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Address returns the address (including the guid of the server) that peers
+// can pass to Dial to connect to s.
+func (s *Server) Address() string {
+	return s.listener.Address() + ",guid=" + s.guid
+}
+
+// Accept waits for the next peer to connect and authenticate and returns the
+// connection to it. Messages on the returned connection are already being
+// processed.
+func (s *Server) Accept() (*Conn, error) {
+	return s.AcceptHandler(NewDefaultHandler(), NewDefaultSignalHandler())
+}
+
+// AcceptHandler works like Accept, but uses the supplied handlers for the
+// returned connection.
+func (s *Server) AcceptHandler(handler Handler, signalHandler SignalHandler) (*Conn, error) {
+	conn, err := s.accept(handler, signalHandler)
+	if err != nil {
+		return nil, err
+	}
+	go conn.inWorker()
+	return conn, nil
+}
+
+// AcceptRaw works like Accept, but doesn't start processing incoming messages
+// on the returned connection. Instead, the caller is responsible for reading
+// them with ReadMessage. Messages that are forwarded unchanged can be sent with
+// SendMessage, which keeps their serial; new messages should be sent with Send,
+// which assigns a fresh one. Both must not be used concurrently. This is
+// mainly useful for message bus implementations, which route messages instead
+// of handling them.
+func (s *Server) AcceptRaw() (*Conn, error) {
+	return s.accept(NewDefaultHandler(), NewDefaultSignalHandler())
+}
+
+// accept waits for the next authenticated transport and creates a connection
+// for it.
+func (s *Server) accept(handler Handler, signalHandler SignalHandler) (*Conn, error) {
+	tr, err := s.acceptTransport()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newConn(tr.transport, handler, signalHandler)
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+	conn.unixFD = tr.unixFD
+	conn.uuid = s.guid
+	conn.peer = tr.creds
+	return conn, nil
+}
+
+func (s *Server) acceptTransport() (*authenticatedTransport, error) {
+	select {
+	case tr := <-s.conns:
+		return tr, nil
+	case <-s.done:
+		s.closeLck.Lock()
+		defer s.closeLck.Unlock()
+		return nil, s.err
+	}
+}
+
+// Close stops listening. Connections that were already returned by Accept
+// are not affected.
+func (s *Server) Close() error {
+	s.shutdown(ErrServerClosed)
+	return s.listener.Close()
+}
+
+func (s *Server) shutdown(err error) {
+	s.closeLck.Lock()
+	defer s.closeLck.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.done)
+}
+
+// serve runs in an own goroutine, accepting new connections and
+// authenticating them.
+func (s *Server) serve() {
+	var delay time.Duration
+	for {
+		tr, err := s.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(interface {
+				Temporary() bool
+			}); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay < time.Second {
+					delay *= 2
+				}
+				time.Sleep(delay)
+				continue
+			}
+			s.shutdown(err)
+			return
+		}
+		delay = 0
+		go s.authenticate(tr)
+	}
+}
+
+// authenticate runs the authentication protocol on tr and passes it on to
+// Accept if it succeeds.
+func (s *Server) authenticate(tr transport) {
+	var creds *PeerCredentials
+	if c, ok := tr.(interface {
+		peerCredentials() (*PeerCredentials, error)
+	}); ok {
+		creds, _ = c.peerCredentials()
+	}
+	setTransportDeadline(tr, time.Now().Add(serverAuthTimeout))
+	unixFD, err := serverAuth(tr, s.methods, s.guid, creds)
+	if err != nil {
+		tr.Close()
+		return
+	}
+	setTransportDeadline(tr, time.Time{})
+	select {
+	case s.conns <- &authenticatedTransport{tr, unixFD, creds}:
+	case <-s.done:
+		tr.Close()
+	}
+}
+
+// setTransportDeadline sets the deadline of the connection underlying tr, if
+// it supports deadlines.
+func setTransportDeadline(tr transport, t time.Time) {
+	var c interface{} = tr
+	if g, ok := tr.(genericTransport); ok {
+		c = g.ReadWriteCloser
+	}
+	if d, ok := c.(interface {
+		SetDeadline(time.Time) error
+	}); ok {
+		d.SetDeadline(t)
+	}
+}
+
+// serverAuth runs the server side of the authentication protocol on tr,
+// offering the given mechanisms. It returns whether passing Unix FDs was
+// negotiated.
+func serverAuth(tr transport, methods []ServerAuth, guid string, creds *PeerCredentials) (bool, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(tr, b[:]); err != nil {
+		return false, err
+	}
+	if b[0] != 0 {
+		return false, errors.New("dbus: authentication protocol error")
+	}
+	var (
+		current ServerAuthHandler
+		ok      bool
+		unixFD  bool
+	)
+	for {
+		s, err := authReadLineUnbuffered(tr)
+		if err != nil {
+			return false, err
+		}
+		cmd := string(s[0])
+		switch {
+		case cmd == "AUTH" && !ok:
+			current = nil
+			if len(s) < 2 || len(s) > 3 {
+				err = authReject(tr, methods)
+				break
+			}
+			for _, m := range methods {
+				if bytes.Equal(m.Name(), s[1]) {
+					current = m.Start(creds)
+					break
+				}
+			}
+			if current == nil {
+				err = authReject(tr, methods)
+				break
+			}
+			var data []byte
+			if len(s) == 3 {
+				data, err = authDecodeData(s[2])
+				if err != nil {
+					current = nil
+					err = authReject(tr, methods)
+					break
+				}
+			}
+			ok, err = authStep(tr, &current, data, methods, guid)
+		case cmd == "DATA" && current != nil:
+			var data []byte
+			if len(s) == 2 {
+				data, err = authDecodeData(s[1])
+			}
+			if len(s) > 2 || err != nil {
+				current = nil
+				err = authReject(tr, methods)
+				break
+			}
+			ok, err = authStep(tr, &current, data, methods, guid)
+		case (cmd == "CANCEL" || cmd == "ERROR") && !ok:
+			current = nil
+			err = authReject(tr, methods)
+		case cmd == "NEGOTIATE_UNIX_FD" && ok:
+			if tr.SupportsUnixFDs() {
+				tr.EnableUnixFDs()
+				unixFD = true
+				err = authWriteLine(tr, []byte("AGREE_UNIX_FD"))
+			} else {
+				err = authWriteLine(tr, []byte("ERROR"),
+					[]byte("Unix fd passing is not supported by the transport"))
+			}
+		case cmd == "BEGIN" && ok:
+			return unixFD, nil
+		default:
+			err = authWriteLine(tr, []byte("ERROR"))
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// authStep passes data to the current mechanism and answers the peer
+// according to its status. It returns whether the peer is authenticated.
+func authStep(out io.Writer, current *ServerAuthHandler, data []byte, methods []ServerAuth, guid string) (bool, error) {
+	challenge, status := (*current).HandleData(data)
+	switch status {
+	case AuthOk:
+		*current = nil
+		return true, authWriteLine(out, []byte("OK"), []byte(guid))
+	case AuthContinue:
+		enc := make([]byte, hex.EncodedLen(len(challenge)))
+		hex.Encode(enc, challenge)
+		if len(enc) == 0 {
+			return false, authWriteLine(out, []byte("DATA"))
+		}
+		return false, authWriteLine(out, []byte("DATA"), enc)
+	default:
+		*current = nil
+		return false, authReject(out, methods)
+	}
+}
+
+// authReject sends a REJECTED command listing the supported mechanisms.
+func authReject(out io.Writer, methods []ServerAuth) error {
+	line := [][]byte{[]byte("REJECTED")}
+	for _, m := range methods {
+		line = append(line, m.Name())
+	}
+	return authWriteLine(out, line...)
+}
+
+func authDecodeData(data []byte) ([]byte, error) {
+	b := make([]byte, hex.DecodedLen(len(data)))
+	_, err := hex.Decode(b, data)
+	return b, err
+}
+
+// authReadLineUnbuffered works like authReadLine, but reads byte by byte, so
+// that no data following the line (i.e. the first message after the BEGIN
+// command) is consumed.
+func authReadLineUnbuffered(in io.Reader) ([][]byte, error) {
+	var (
+		line []byte
+		b    [1]byte
+	)
+	for {
+		if _, err := io.ReadFull(in, b[:]); err != nil {
+			return nil, err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+		if len(line) > maxAuthLineLength {
+			return nil, errors.New("dbus: authentication line too long")
+		}
+	}
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return bytes.Split(line, []byte{' '}), nil
+}
+
+// newGUID returns a new random, hex-encoded server guid.
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func getListener(address string) (listener, error) {
+	var err error
+	var l listener
+
+	addresses := strings.Split(address, ";")
+	for _, v := range addresses {
+		i := strings.IndexRune(v, ':')
+		if i == -1 {
+			err = errors.New("dbus: invalid bus address (no transport)")
+			continue
+		}
+		f := listeners[v[:i]]
+		if f == nil {
+			err = errors.New("dbus: invalid bus address (invalid or unsupported transport)")
+			continue
+		}
+		l, err = f(v[i+1:])
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, err
+}
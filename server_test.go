@@ -0,0 +1,128 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type serverTest struct{}
+
+func (serverTest) Double(n int64) (int64, *Error) {
+	return 2 * n, nil
+}
+
+func testServer(t *testing.T, address string, methods []ServerAuth, auth []Auth) {
+	srv, err := ListenAuth(address, methods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	accepted := make(chan *Conn, 1)
+	go func() {
+		conn, err := srv.Accept()
+		if err != nil {
+			t.Error(err)
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := Dial(srv.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err = client.Auth(auth); err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	defer server.Close()
+
+	server.Export(serverTest{}, "/org/guelfey/DBus/Test", "org.guelfey.DBus.Test")
+	var n int64
+	obj := client.Object("", "/org/guelfey/DBus/Test")
+	if err = obj.Call("org.guelfey.DBus.Test.Double", 0, int64(2)).Store(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("Response was %d, expected 4", n)
+	}
+
+	// calls work in both directions
+	client.Export(serverTest{}, "/org/guelfey/DBus/Test", "org.guelfey.DBus.Test")
+	obj = server.Object("", "/org/guelfey/DBus/Test")
+	if err = obj.Call("org.guelfey.DBus.Test.Double", 0, int64(3)).Store(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("Response was %d, expected 6", n)
+	}
+}
+
+func TestServerUnixExternal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	uid := strconv.Itoa(os.Getuid())
+	testServer(t, "unix:path="+filepath.Join(dir, "socket"),
+		[]ServerAuth{ServerAuthExternal()}, []Auth{AuthExternal(uid)})
+}
+
+func TestServerTcpAnonymous(t *testing.T) {
+	testServer(t, "tcp:host=127.0.0.1,port=0",
+		[]ServerAuth{ServerAuthAnonymous()}, []Auth{AuthAnonymous()})
+}
+
+func TestServerTcpCookieSha1(t *testing.T) {
+	home, err := ioutil.TempDir("", "dbus-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	uid := strconv.Itoa(os.Getuid())
+	testServer(t, "tcp:host=127.0.0.1,port=0",
+		[]ServerAuth{ServerAuthCookieSha1(home)}, []Auth{AuthCookieSha1(uid, home)})
+}
+
+func TestServerRejectsUnknownUid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbus-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv, err := ListenAuth("unix:path="+filepath.Join(dir, "socket"),
+		[]ServerAuth{ServerAuthExternal(uint32(os.Getuid()) + 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	client, err := Dial(srv.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err = client.Auth([]Auth{AuthExternal(strconv.Itoa(os.Getuid()))}); err == nil {
+		t.Error("Expected authentication to fail")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv, err := ListenAuth("tcp:host=127.0.0.1,port=0", []ServerAuth{ServerAuthAnonymous()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	if _, err := srv.Accept(); err != ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
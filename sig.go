@@ -77,6 +77,9 @@ func getSignature(t reflect.Type) Signature {
 		if t == objectPathType {
 			return "o"
 		}
+		if t == signatureType {
+			return "g"
+		}
 		return "s"
 	case reflect.Struct:
 		if t == variantType {
@@ -0,0 +1,195 @@
+package dbus
+
+import "sync"
+
+// OverflowPolicy determines what happens to a signal that arrives for a
+// channel whose queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest discards the signal that arrived.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest queued signal to make room for
+	// the new one.
+	OverflowDropOldest
+
+	// OverflowBlock waits until there is room in the queue. As signals are
+	// queued by the goroutine that reads incoming messages, this stalls the
+	// whole connection until the channel is read from. This is the default,
+	// so that no signal is lost.
+	OverflowBlock
+
+	// OverflowDisconnect unregisters the channel, as RemoveSignal and
+	// Unsubscribe do, and closes it.
+	OverflowDisconnect
+)
+
+// defaultSignalQueueSize is the number of signals that are queued for a
+// channel unless SetSignalQueue is used.
+const defaultSignalQueueSize = 64
+
+// signalQueue queues the signals for a channel and sends them to it in order
+// from an own goroutine.
+type signalQueue struct {
+	ch chan<- *Signal
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []*Signal
+	size    int
+	policy  OverflowPolicy
+	dropped uint64
+	running bool
+	stopped bool
+	done    chan struct{}
+	exited  chan struct{}
+
+	// onDrop is called when a signal is discarded, if it is set.
+	onDrop func()
+}
+
+func newSignalQueue(ch chan<- *Signal) *signalQueue {
+	q := &signalQueue{
+		ch:     ch,
+		size:   defaultSignalQueueSize,
+		policy: OverflowBlock,
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *signalQueue) configure(size int, policy OverflowPolicy) {
+	if size < 1 {
+		size = 1
+	}
+	q.mu.Lock()
+	q.size = size
+	q.policy = policy
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// push queues signal. It returns false if the queue is full and the channel
+// must be disconnected.
+func (q *signalQueue) push(signal *Signal) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return true
+	}
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	for len(q.buf) >= q.size {
+		switch q.policy {
+		case OverflowDropOldest:
+			q.buf[0] = nil
+			q.buf = q.buf[1:]
+			q.drop()
+		case OverflowBlock:
+			q.cond.Wait()
+			if q.stopped {
+				return true
+			}
+		case OverflowDisconnect:
+			q.drop()
+			return false
+		default:
+			q.drop()
+			return true
+		}
+	}
+	q.buf = append(q.buf, signal)
+	q.cond.Broadcast()
+	return true
+}
+
+func (q *signalQueue) run() {
+	defer close(q.exited)
+	for {
+		q.mu.Lock()
+		for len(q.buf) == 0 && !q.stopped {
+			q.cond.Wait()
+		}
+		if q.stopped {
+			q.mu.Unlock()
+			return
+		}
+		signal := q.buf[0]
+		q.buf[0] = nil
+		q.buf = q.buf[1:]
+		q.cond.Broadcast()
+		q.mu.Unlock()
+		select {
+		case q.ch <- signal:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// stop discards the queued signals and waits until no more signals are sent
+// to the channel.
+func (q *signalQueue) stop() {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+	q.stopped = true
+	q.buf = nil
+	running := q.running
+	close(q.done)
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	if running {
+		<-q.exited
+	}
+}
+
+// drop counts a discarded signal. q must be locked.
+func (q *signalQueue) drop() {
+	q.dropped++
+	if q.onDrop != nil {
+		q.onDrop()
+	}
+}
+
+func (q *signalQueue) droppedSignals() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// SetSignalQueue sets the number of signals that are queued for ch, which
+// must have been passed to Signal or Subscribe, and what happens to signals
+// that arrive when the queue is full. By default, 64 signals are queued and
+// OverflowBlock is used, i.e. no signal is discarded, but a channel that isn't
+// read from stalls the connection once its queue is full. The signals for a
+// channel are always sent to it in the order in which they were received.
+func (conn *Conn) SetSignalQueue(ch chan<- *Signal, size int, policy OverflowPolicy) {
+	handler, ok := conn.signalHandler.(*defaultSignalHandler)
+	if !ok {
+		return
+	}
+	if q := handler.queue(ch); q != nil {
+		q.configure(size, policy)
+	}
+}
+
+// DroppedSignals returns the number of signals for ch that were discarded
+// because its queue was full.
+func (conn *Conn) DroppedSignals(ch chan<- *Signal) uint64 {
+	handler, ok := conn.signalHandler.(*defaultSignalHandler)
+	if !ok {
+		return 0
+	}
+	if q := handler.queue(ch); q != nil {
+		return q.droppedSignals()
+	}
+	return 0
+}
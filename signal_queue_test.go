@@ -0,0 +1,129 @@
+package dbus
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// deliver delivers signals with the arguments from, ..., to-1.
+func deliver(sh *defaultSignalHandler, from, to int) {
+	for i := from; i < to; i++ {
+		sh.DeliverSignal("org.guelfey.DBus.Test", "Seq", &Signal{
+			Path: "/", Name: "org.guelfey.DBus.Test.Seq", Body: []interface{}{strconv.Itoa(i)},
+		})
+	}
+}
+
+func TestSignalQueueOrder(t *testing.T) {
+	sh := NewDefaultSignalHandler()
+	ch := make(chan *Signal)
+	sh.addSignal(ch)
+	sh.queue(ch).configure(1000, OverflowBlock)
+	go deliver(sh, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		select {
+		case sig := <-ch:
+			if sig.Body[0] != strconv.Itoa(i) {
+				t.Fatalf("received signal %v, expected %d", sig.Body[0], i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not received")
+		}
+	}
+	sh.Terminate()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed")
+	}
+}
+
+func TestSignalQueueDefaultBlocks(t *testing.T) {
+	sh := NewDefaultSignalHandler()
+	ch := make(chan *Signal)
+	sh.addSignal(ch)
+	n := 2 * defaultSignalQueueSize
+	go deliver(sh, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case sig := <-ch:
+			if sig.Body[0] != strconv.Itoa(i) {
+				t.Fatalf("received signal %v, expected %d", sig.Body[0], i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not received")
+		}
+	}
+	if n := sh.queue(ch).droppedSignals(); n != 0 {
+		t.Errorf("%d signals dropped", n)
+	}
+	sh.Terminate()
+}
+
+// waitSending waits until the queue has passed its first signal to the
+// channel, i.e. it is blocked sending it.
+func waitSending(q *signalQueue) {
+	for {
+		q.mu.Lock()
+		empty := len(q.buf) == 0
+		q.mu.Unlock()
+		if empty {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSignalQueueOverflow(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		second string
+	}{
+		{OverflowDropNewest, "1"},
+		{OverflowDropOldest, "9"},
+	}
+	for _, test := range tests {
+		sh := NewDefaultSignalHandler()
+		ch := make(chan *Signal)
+		sh.addSignal(ch)
+		q := sh.queue(ch)
+		q.configure(2, test.policy)
+		deliver(sh, 0, 1)
+		waitSending(q)
+		// two of the remaining signals fit into the queue
+		deliver(sh, 1, 11)
+		if q.droppedSignals() != 8 {
+			t.Errorf("policy %d: %d signals dropped, expected 8", test.policy, q.droppedSignals())
+		}
+		if sig := <-ch; sig.Body[0] != "0" {
+			t.Errorf("policy %d: received %v, expected 0", test.policy, sig.Body[0])
+		}
+		if sig := <-ch; sig.Body[0] != test.second {
+			t.Errorf("policy %d: received %v, expected %s", test.policy, sig.Body[0], test.second)
+		}
+		sh.Terminate()
+	}
+}
+
+func TestSignalQueueDisconnect(t *testing.T) {
+	sh := NewDefaultSignalHandler()
+	ch := make(chan *Signal)
+	other := make(chan *Signal, 10)
+	sh.addSignal(ch)
+	sh.addSignal(other)
+	sh.queue(ch).configure(1, OverflowDisconnect)
+	deliver(sh, 0, 5)
+	if sh.queue(ch) != nil {
+		t.Fatal("channel was not disconnected")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel was not closed")
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-other:
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not received on the other channel")
+		}
+	}
+	sh.Terminate()
+}
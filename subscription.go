@@ -0,0 +1,244 @@
+package dbus
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Subscription is a channel that is registered for the signals that match a
+// match rule. It is created by Subscribe.
+type Subscription struct {
+	conn    *Conn
+	ch      chan<- *Signal
+	options []MatchOption
+	filter  *signalFilter
+	once    sync.Once
+}
+
+// Subscribe adds a match rule with the given options to the bus (as
+// AddMatchSignal does) and registers ch to receive the signals that match it.
+// Unlike for channels passed to Signal, the rule is also evaluated locally, so
+// ch only receives the signals that it asked for, even if other parts of the
+// program add other rules to the same connection.
+//
+// Signals are queued for ch as described for Signal. Like the channels
+// passed to Signal, ch is closed when the connection is closed.
+// Subscribe only works for connections that use the default signal handler.
+func (conn *Conn) Subscribe(ch chan<- *Signal, options ...MatchOption) (*Subscription, error) {
+	handler, ok := conn.signalHandler.(*defaultSignalHandler)
+	if !ok {
+		return nil, errors.New("dbus: signal handler doesn't support subscriptions")
+	}
+	filter, err := newSignalFilter(options)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.AddMatchSignal(options...); err != nil {
+		return nil, err
+	}
+	if filter.tracksOwner {
+		// signals carry the unique name of the sender, so the owner of the
+		// well-known name has to be tracked.
+		err = conn.AddMatchSignal(nameOwnerChangedOptions(filter.sender)...)
+		if err != nil {
+			conn.RemoveMatchSignal(options...)
+			return nil, err
+		}
+	}
+	sub := &Subscription{conn: conn, ch: ch, options: options, filter: filter}
+	handler.addSubscription(sub)
+	if filter.tracksOwner {
+		var owner string
+		if conn.busObj.Call("org.freedesktop.DBus.GetNameOwner", 0, filter.sender).Store(&owner) == nil {
+			filter.setInitialOwner(owner)
+		}
+	}
+	return sub, nil
+}
+
+// Unsubscribe unregisters the channel of the subscription and removes its
+// match rule from the bus. The channel is not closed.
+func (sub *Subscription) Unsubscribe() error {
+	var err error
+	sub.once.Do(func() {
+		sub.conn.signalHandler.(*defaultSignalHandler).removeSubscription(sub)
+		if sub.filter.tracksOwner {
+			sub.conn.RemoveMatchSignal(nameOwnerChangedOptions(sub.filter.sender)...)
+		}
+		err = sub.conn.RemoveMatchSignal(sub.options...)
+	})
+	return err
+}
+
+func nameOwnerChangedOptions(name string) []MatchOption {
+	return []MatchOption{
+		WithMatchSender("org.freedesktop.DBus"),
+		WithMatchInterface("org.freedesktop.DBus"),
+		WithMatchMember("NameOwnerChanged"),
+		WithMatchArg(0, name),
+	}
+}
+
+// signalArg is an argN, argNpath or arg0namespace condition of a match rule.
+type signalArg struct {
+	index int
+	value string
+	kind  string // "", "path" or "namespace"
+}
+
+// signalFilter evaluates a match rule for received signals.
+type signalFilter struct {
+	sender        string
+	path          ObjectPath
+	pathNamespace ObjectPath
+	iface         string
+	member        string
+	args          []signalArg
+
+	// tracksOwner is true if sender is a well-known name; owner is its
+	// current owner.
+	tracksOwner bool
+	ownerLck    sync.RWMutex
+	owner       string
+	ownerKnown  bool
+}
+
+func newSignalFilter(options []MatchOption) (*signalFilter, error) {
+	f := new(signalFilter)
+	for _, option := range options {
+		switch option.key {
+		case "type":
+			if option.value != "signal" {
+				return nil, errors.New("dbus: subscriptions only match signals")
+			}
+		case "sender":
+			f.sender = option.value
+		case "path":
+			f.path = ObjectPath(option.value)
+		case "path_namespace":
+			f.pathNamespace = ObjectPath(option.value)
+		case "interface":
+			f.iface = option.value
+		case "member":
+			f.member = option.value
+		case "destination", "eavesdrop":
+			// only evaluated by the bus
+		case "arg0namespace":
+			f.args = append(f.args, signalArg{0, option.value, "namespace"})
+		default:
+			if !strings.HasPrefix(option.key, "arg") {
+				return nil, errors.New("dbus: invalid match rule key " + option.key)
+			}
+			n := option.key[3:]
+			kind := ""
+			if strings.HasSuffix(n, "path") {
+				n = n[:len(n)-4]
+				kind = "path"
+			}
+			i, err := strconv.Atoi(n)
+			if err != nil || i < 0 || i > 63 {
+				return nil, errors.New("dbus: invalid match rule key " + option.key)
+			}
+			f.args = append(f.args, signalArg{i, option.value, kind})
+		}
+	}
+	f.tracksOwner = f.sender != "" && !strings.HasPrefix(f.sender, ":") && f.sender != "org.freedesktop.DBus"
+	return f, nil
+}
+
+// setInitialOwner sets the owner of the sender name as returned by
+// GetNameOwner, unless it has already been updated by a signal.
+func (f *signalFilter) setInitialOwner(owner string) {
+	f.ownerLck.Lock()
+	defer f.ownerLck.Unlock()
+	if !f.ownerKnown {
+		f.owner = owner
+		f.ownerKnown = true
+	}
+}
+
+// update tracks the owner of the sender name if signal is a matching
+// NameOwnerChanged signal.
+func (f *signalFilter) update(signal *Signal) {
+	if !f.tracksOwner || signal.Sender != "org.freedesktop.DBus" ||
+		signal.Name != "org.freedesktop.DBus.NameOwnerChanged" || len(signal.Body) != 3 {
+		return
+	}
+	name, _ := signal.Body[0].(string)
+	owner, _ := signal.Body[2].(string)
+	if name != f.sender {
+		return
+	}
+	f.ownerLck.Lock()
+	f.owner = owner
+	f.ownerKnown = true
+	f.ownerLck.Unlock()
+}
+
+// matches returns whether signal matches the rule of f.
+func (f *signalFilter) matches(signal *Signal) bool {
+	if f.sender != "" && f.sender != signal.Sender {
+		if !f.tracksOwner {
+			return false
+		}
+		f.ownerLck.RLock()
+		owner := f.owner
+		f.ownerLck.RUnlock()
+		if owner == "" || owner != signal.Sender {
+			return false
+		}
+	}
+	if f.path != "" && f.path != signal.Path {
+		return false
+	}
+	if f.pathNamespace != "" && f.pathNamespace != "/" && f.pathNamespace != signal.Path &&
+		!strings.HasPrefix(string(signal.Path), string(f.pathNamespace)+"/") {
+		return false
+	}
+	i := strings.LastIndex(signal.Name, ".")
+	if i == -1 {
+		return false
+	}
+	if f.iface != "" && f.iface != signal.Name[:i] {
+		return false
+	}
+	if f.member != "" && f.member != signal.Name[i+1:] {
+		return false
+	}
+	for _, arg := range f.args {
+		if arg.index >= len(signal.Body) {
+			return false
+		}
+		var s string
+		switch v := signal.Body[arg.index].(type) {
+		case string:
+			s = v
+		case ObjectPath:
+			if arg.kind != "path" {
+				return false
+			}
+			s = string(v)
+		default:
+			return false
+		}
+		switch arg.kind {
+		case "":
+			if s != arg.value {
+				return false
+			}
+		case "path":
+			if s != arg.value &&
+				!(strings.HasSuffix(arg.value, "/") && strings.HasPrefix(s, arg.value)) &&
+				!(strings.HasSuffix(s, "/") && strings.HasPrefix(arg.value, s)) {
+				return false
+			}
+		case "namespace":
+			if s != arg.value && !strings.HasPrefix(s, arg.value+".") {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func connectSessionBus(t *testing.T) *Conn {
+	conn, err := SessionBusPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func expectSignal(t *testing.T, ch <-chan *Signal, name string) {
+	select {
+	case sig := <-ch:
+		if sig.Name != name {
+			t.Errorf("received signal %s, expected %s", sig.Name, name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("signal %s not received", name)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	receiver := connectSessionBus(t)
+	defer receiver.Close()
+	sender := connectSessionBus(t)
+	defer sender.Close()
+
+	const name = "org.guelfey.DBus.Subscribe"
+	if _, err := sender.RequestName(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	foo := make(chan *Signal, 10)
+	fooSub, err := receiver.Subscribe(foo,
+		WithMatchSender(name), WithMatchInterface("org.guelfey.DBus.Test"), WithMatchMember("Foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar := make(chan *Signal, 10)
+	barSub, err := receiver.Subscribe(bar,
+		WithMatchInterface("org.guelfey.DBus.Test"), WithMatchMember("Bar"), WithMatchArg(0, "yes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Foo")
+	sender.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Bar", "no")
+	sender.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Bar", "yes")
+	expectSignal(t, foo, "org.guelfey.DBus.Test.Foo")
+	expectSignal(t, bar, "org.guelfey.DBus.Test.Bar")
+	select {
+	case sig := <-foo:
+		t.Errorf("unexpected signal %v", sig)
+	case sig := <-bar:
+		t.Errorf("unexpected signal %v", sig)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err = fooSub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if err = barSub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	rule := signalMatchRule([]MatchOption{WithMatchInterface("org.guelfey.DBus.Test"), WithMatchMember("Bar"), WithMatchArg(0, "yes")})
+	if err = receiver.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err; err == nil {
+		t.Error("Unsubscribe didn't remove the rule from the bus")
+	}
+}
+
+func TestSubscribeSignalChannel(t *testing.T) {
+	receiver := connectSessionBus(t)
+	defer receiver.Close()
+	sender := connectSessionBus(t)
+	defer sender.Close()
+
+	// the channel gets the signal once, though it is registered three times
+	ch := make(chan *Signal, 10)
+	receiver.Signal(ch)
+	for i := 0; i < 2; i++ {
+		if _, err := receiver.Subscribe(ch, WithMatchInterface("org.guelfey.DBus.Test")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sender.Emit("/org/guelfey/DBus/Test", "org.guelfey.DBus.Test.Foo")
+	n := 0
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case sig := <-ch:
+			if sig.Name == "org.guelfey.DBus.Test.Foo" {
+				n++
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	if n != 1 {
+		t.Errorf("received the signal %d times", n)
+	}
+}
+
+func TestSignalFilter(t *testing.T) {
+	f, err := newSignalFilter([]MatchOption{
+		WithMatchPathNamespace("/org/guelfey"),
+		WithMatchArgPath(0, "/a/"),
+		WithMatchArg0Namespace("/a"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.matches(&Signal{Path: "/org/guelfey/x", Name: "a.b", Body: []interface{}{"/a/b"}}) {
+		t.Error("arg0namespace is not evaluated")
+	}
+	f, err = newSignalFilter([]MatchOption{
+		WithMatchPathNamespace("/org/guelfey"),
+		WithMatchArgPath(0, "/a/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.matches(&Signal{Path: "/org/guelfey/x", Name: "a.b", Body: []interface{}{ObjectPath("/a/b")}}) {
+		t.Error("matching signal was rejected")
+	}
+	if f.matches(&Signal{Path: "/org/guelfeyx", Name: "a.b", Body: []interface{}{"/a/b"}}) {
+		t.Error("path_namespace is not evaluated")
+	}
+	if _, err = newSignalFilter([]MatchOption{WithMatchType(TypeMethodCall)}); err == nil {
+		t.Error("subscription for method calls was accepted")
+	}
+}
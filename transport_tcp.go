@@ -9,6 +9,7 @@ import (
 
 func init() {
 	transports["tcp"] = newTcpTransport
+	listeners["tcp"] = newTcpListener
 }
 
 func tcpFamily(keys string) (string, error) {
@@ -41,3 +42,46 @@ func newTcpTransport(keys string) (transport, error) {
 	}
 	return NewConn(socket)
 }
+
+type tcpListener struct {
+	net.Listener
+	family string
+}
+
+func newTcpListener(keys string) (listener, error) {
+	host := getKey(keys, "host")
+	port := getKey(keys, "port")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "0"
+	}
+
+	protocol, err := tcpFamily(keys)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen(protocol, net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	return &tcpListener{l, getKey(keys, "family")}, nil
+}
+
+func (l *tcpListener) Accept() (transport, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return genericTransport{conn}, nil
+}
+
+func (l *tcpListener) Address() string {
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	address := "tcp:host=" + host + ",port=" + port
+	if l.family != "" {
+		address += ",family=" + l.family
+	}
+	return address
+}
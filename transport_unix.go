@@ -62,6 +62,50 @@ func newUnixTransport(keys string) (transport, error) {
 
 func init() {
 	transports["unix"] = newUnixTransport
+	listeners["unix"] = newUnixListener
+}
+
+type unixListener struct {
+	*net.UnixListener
+	address string
+}
+
+func newUnixListener(keys string) (listener, error) {
+	var (
+		l       *net.UnixListener
+		address string
+		err     error
+	)
+	abstract := getKey(keys, "abstract")
+	path := getKey(keys, "path")
+	switch {
+	case abstract == "" && path == "":
+		return nil, errors.New("dbus: invalid address (neither path nor abstract set)")
+	case abstract != "" && path == "":
+		l, err = net.ListenUnix("unix", &net.UnixAddr{Name: "@" + abstract, Net: "unix"})
+		address = "unix:abstract=" + abstract
+	case abstract == "" && path != "":
+		l, err = net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		address = "unix:path=" + path
+	default:
+		return nil, errors.New("dbus: invalid address (both path and abstract set)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &unixListener{l, address}, nil
+}
+
+func (l *unixListener) Accept() (transport, error) {
+	conn, err := l.AcceptUnix()
+	if err != nil {
+		return nil, err
+	}
+	return &unixTransport{UnixConn: conn}, nil
+}
+
+func (l *unixListener) Address() string {
+	return l.address
 }
 
 func (t *unixTransport) EnableUnixFDs() {
@@ -23,3 +23,24 @@ func (t *unixTransport) SendNullByte() error {
 	}
 	return nil
 }
+
+func (t *unixTransport) peerCredentials() (*PeerCredentials, error) {
+	raw, err := t.UnixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ucred *syscall.Ucred
+		uerr  error
+	)
+	err = raw.Control(func(fd uintptr) {
+		ucred, uerr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uerr != nil {
+		return nil, uerr
+	}
+	return &PeerCredentials{Pid: uint32(ucred.Pid), Uid: ucred.Uid, Gid: ucred.Gid}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows && !solaris
+// +build !linux,!windows,!solaris
+
+package dbus
+
+import "errors"
+
+func (t *unixTransport) peerCredentials() (*PeerCredentials, error) {
+	return nil, errors.New("dbus: peer credentials are not supported on this platform")
+}